@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	adminhttp "l0/internal/http"
+)
+
+const adminUsage = `Использование: l0 admin [флаги] <команда>
+
+Команды:
+  status                     состояние консьюмера
+  pause                      приостановить чтение заказов
+  resume                     возобновить чтение
+  reset -to <earliest|latest|timestamp|offset> [-timestamp RFC3339] [-offset N] [-partition N]
+                             сбросить смещения группы (только на паузе)
+
+Флаги:
+`
+
+// Подкоманда admin: обращение к служебным эндпоинтам запущенного сервиса
+func runAdmin(args []string) int {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:"+getEnv("HTTP_PORT", "8081"), "адрес сервиса")
+	token := fs.String("token", getEnv("ADMIN_TOKEN", ""), "токен администратора (по умолчанию ADMIN_TOKEN)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), adminUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var method, path string
+	var body interface{}
+	switch command := fs.Arg(0); command {
+	case "status":
+		method, path = http.MethodGet, "/admin/consumer"
+	case "pause", "resume":
+		method, path = http.MethodPost, "/admin/consumer/"+command
+	case "reset":
+		req, err := parseResetArgs(fs.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		method, path, body = http.MethodPost, "/admin/consumer/reset-offsets", req
+	default:
+		fmt.Fprintf(os.Stderr, "Неизвестная команда %q\n", command)
+		fs.Usage()
+		return 2
+	}
+
+	response, err := adminRequest(strings.TrimRight(*addr, "/")+path, method, *token, body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(response)
+	return 0
+}
+
+func parseResetArgs(args []string) (adminhttp.ResetOffsetsRequest, error) {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	to := fs.String("to", "", "earliest, latest, timestamp или offset")
+	timestamp := fs.String("timestamp", "", "время в формате RFC3339 для -to timestamp")
+	offset := fs.Int64("offset", 0, "смещение для -to offset")
+	partition := fs.Int("partition", -1, "партиция для -to offset (по умолчанию все)")
+	if err := fs.Parse(args); err != nil {
+		return adminhttp.ResetOffsetsRequest{}, err
+	}
+
+	req := adminhttp.ResetOffsetsRequest{To: *to, Offset: *offset}
+	if *timestamp != "" {
+		t, err := time.Parse(time.RFC3339, *timestamp)
+		if err != nil {
+			return req, fmt.Errorf("неверный формат -timestamp: %v", err)
+		}
+		req.Timestamp = t
+	}
+	if *partition >= 0 {
+		req.Partition = partition
+	}
+	return req, nil
+}
+
+func adminRequest(url, method, token string, body interface{}) (string, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ошибка запроса к сервису: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("сервис вернул %v: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return string(data), nil
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"hash/fnv"
 	"l0/internal/model"
 	"sync"
 )
@@ -9,14 +10,23 @@ type CacheRepository interface {
 	Load(orders map[string]model.Order)
 	GetOrder(orderUID string) (model.Order, bool)
 	SetOrder(order model.Order)
+	Generation(orderUID string) uint64
+	SetOrderIfUnchanged(order model.Order, generation uint64) bool
+	DeleteOrder(orderUID string)
+	UpdateItemStatus(orderUID string, chrtID int, rid string, status int) bool
 	evictIfNeeded()
 }
 
+// Число счётчиков записей: заказы распределяются по ним хэшем order_uid
+const generationStripes = 256
+
 type Cache struct {
 	orders      *sync.Map // Используем указатель для безопасной замены
 	orderList   []string
 	orderListMu sync.Mutex
 	maxSize     int
+	// Счётчики записей в кэш по хэшу order_uid, меняются под orderListMu
+	generations [generationStripes]uint64
 }
 
 func NewCache(maxSize int) *Cache {
@@ -36,6 +46,9 @@ func (c *Cache) Load(orders map[string]model.Order) {
 
 	c.orderListMu.Lock()
 	defer c.orderListMu.Unlock()
+	for i := range c.generations {
+		c.generations[i]++
+	}
 	c.orderList = make([]string, 0, len(orders))
 	for uid := range orders {
 		c.orderList = append(c.orderList, uid)
@@ -52,17 +65,92 @@ func (c *Cache) GetOrder(orderUID string) (model.Order, bool) {
 	return order, ok
 }
 
+// Все записи в кэш идут под orderListMu: иначе UpdateItemStatus мог бы сохранить
+// поверх нового заказа старую копию с изменённым статусом
 func (c *Cache) SetOrder(order model.Order) {
-	_, exists := c.orders.Load(order.OrderUID)
-	if !exists {
-		c.orderListMu.Lock()
-		defer c.orderListMu.Unlock()
+	c.orderListMu.Lock()
+	defer c.orderListMu.Unlock()
+	c.storeLocked(order)
+}
+
+// Номер последней записи в кэш, затронувшей orderUID. Снимается перед чтением
+// заказа из БД и передаётся в SetOrderIfUnchanged
+func (c *Cache) Generation(orderUID string) uint64 {
+	c.orderListMu.Lock()
+	defer c.orderListMu.Unlock()
+	return c.generations[stripe(orderUID)]
+}
+
+// Запись заказа, прочитанного из БД, только если с момента generation заказ
+// в кэше не менялся. Иначе консьюмер мог успеть удалить или обновить заказ, пока
+// он читался, и прочитанная копия вернула бы в кэш удалённый или старый заказ.
+// Счётчик общий для заказов с одним хэшем, поэтому изредка запись пропускается
+// зря — тогда заказ просто прочитается из БД ещё раз. false — заказ не записан
+func (c *Cache) SetOrderIfUnchanged(order model.Order, generation uint64) bool {
+	c.orderListMu.Lock()
+	defer c.orderListMu.Unlock()
+
+	if c.generations[stripe(order.OrderUID)] != generation {
+		return false
+	}
+	c.storeLocked(order)
+	return true
+}
+
+func (c *Cache) storeLocked(order model.Order) {
+	c.generations[stripe(order.OrderUID)]++
+	if _, exists := c.orders.Load(order.OrderUID); !exists {
 		c.orderList = append(c.orderList, order.OrderUID)
 	}
 	c.orders.Store(order.OrderUID, order)
 	c.evictIfNeeded()
 }
 
+func (c *Cache) DeleteOrder(orderUID string) {
+	c.orderListMu.Lock()
+	defer c.orderListMu.Unlock()
+	// Счётчик меняется, даже если заказа в кэше нет: его может читать из БД read-through
+	c.generations[stripe(orderUID)]++
+	c.orders.Delete(orderUID)
+	for i, uid := range c.orderList {
+		if uid == orderUID {
+			c.orderList = append(c.orderList[:i], c.orderList[i+1:]...)
+			break
+		}
+	}
+}
+
+// Обновление статуса товара в закэшированном заказе. Непустой rid выбирает одну строку
+// заказа, пустой — все строки с этим chrt_id. false — заказа или товара в кэше нет.
+// Срез товаров копируется, чтобы не менять заказ, уже отданный читателям
+func (c *Cache) UpdateItemStatus(orderUID string, chrtID int, rid string, status int) bool {
+	c.orderListMu.Lock()
+	defer c.orderListMu.Unlock()
+
+	order, ok := c.GetOrder(orderUID)
+	if !ok {
+		return false
+	}
+
+	items := make([]model.Item, len(order.Items))
+	copy(items, order.Items)
+	updated := false
+	for i := range items {
+		if items[i].ChrtID == chrtID && (rid == "" || items[i].RID == rid) {
+			items[i].Status = status
+			updated = true
+		}
+	}
+	if !updated {
+		return false
+	}
+
+	order.Items = items
+	c.generations[stripe(orderUID)]++
+	c.orders.Store(orderUID, order)
+	return true
+}
+
 func (c *Cache) evictIfNeeded() {
 	for len(c.orderList) > c.maxSize {
 		oldestUID := c.orderList[0]
@@ -70,3 +158,9 @@ func (c *Cache) evictIfNeeded() {
 		c.orderList = c.orderList[1:]
 	}
 }
+
+func stripe(orderUID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(orderUID))
+	return h.Sum32() % generationStripes
+}
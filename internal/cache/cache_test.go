@@ -11,6 +11,10 @@ type MockCacheRepository struct {
 	loadFn      func(orders map[string]model.Order)
 	getOrderFn  func(orderUID string) (model.Order, bool)
 	setOrderFn  func(order model.Order)
+	generationFn func(orderUID string) uint64
+	setIfUnchangedFn func(order model.Order, generation uint64) bool
+	deleteFn    func(orderUID string)
+	updateFn    func(orderUID string, chrtID int, rid string, status int) bool
 	evictFn     func()
 }
 
@@ -33,6 +37,33 @@ func (m *MockCacheRepository) SetOrder(order model.Order) {
 	}
 }
 
+func (m *MockCacheRepository) Generation(orderUID string) uint64 {
+	if m.generationFn != nil {
+		return m.generationFn(orderUID)
+	}
+	return 0
+}
+
+func (m *MockCacheRepository) SetOrderIfUnchanged(order model.Order, generation uint64) bool {
+	if m.setIfUnchangedFn != nil {
+		return m.setIfUnchangedFn(order, generation)
+	}
+	return false
+}
+
+func (m *MockCacheRepository) DeleteOrder(orderUID string) {
+	if m.deleteFn != nil {
+		m.deleteFn(orderUID)
+	}
+}
+
+func (m *MockCacheRepository) UpdateItemStatus(orderUID string, chrtID int, rid string, status int) bool {
+	if m.updateFn != nil {
+		return m.updateFn(orderUID, chrtID, rid, status)
+	}
+	return false
+}
+
 func (m *MockCacheRepository) evictIfNeeded() {
 	if m.evictFn != nil {
 		m.evictFn()
@@ -156,6 +187,104 @@ func TestCache_Eviction(t *testing.T) {
 	}
 }
 
+func TestCache_DeleteOrder(t *testing.T) {
+	cache := NewCache(2)
+	cache.SetOrder(newValidOrder("1"))
+	cache.SetOrder(newValidOrder("2"))
+
+	cache.DeleteOrder("1")
+
+	if _, ok := cache.GetOrder("1"); ok {
+		t.Error("Order '1' should have been deleted")
+	}
+
+	// Освободившееся место не должно вытеснять оставшиеся заказы
+	cache.SetOrder(newValidOrder("3"))
+	if _, ok := cache.GetOrder("2"); !ok {
+		t.Error("Order '2' should still be present")
+	}
+	if _, ok := cache.GetOrder("3"); !ok {
+		t.Error("Order '3' should be present")
+	}
+}
+
+func TestCache_UpdateItemStatus(t *testing.T) {
+	cache := NewCache(2)
+	order := newValidOrder("1")
+	cache.SetOrder(order)
+
+	if !cache.UpdateItemStatus("1", 123456, "", 300) {
+		t.Fatal("Item status should have been updated")
+	}
+	updated, _ := cache.GetOrder("1")
+	if updated.Items[0].Status != 300 {
+		t.Errorf("Expected status 300, got %v", updated.Items[0].Status)
+	}
+	// Ранее отданный заказ не должен меняться
+	if order.Items[0].Status != 200 {
+		t.Errorf("Original order should keep status 200, got %v", order.Items[0].Status)
+	}
+
+	if cache.UpdateItemStatus("1", 1, "", 300) {
+		t.Error("Unknown item should not be updated")
+	}
+	if cache.UpdateItemStatus("2", 123456, "", 300) {
+		t.Error("Order that is not cached should not be updated")
+	}
+}
+
+func TestCache_UpdateItemStatusByRID(t *testing.T) {
+	cache := NewCache(2)
+	order := newValidOrder("1")
+	// Тот же товар второй строкой заказа
+	second := order.Items[0]
+	second.RID = "rid456"
+	order.Items = append(order.Items, second)
+	cache.SetOrder(order)
+
+	if !cache.UpdateItemStatus("1", 123456, "rid456", 300) {
+		t.Fatal("Item status should have been updated")
+	}
+	updated, _ := cache.GetOrder("1")
+	if updated.Items[0].Status != 200 || updated.Items[1].Status != 300 {
+		t.Errorf("Expected only second line to change, got statuses %v and %v",
+			updated.Items[0].Status, updated.Items[1].Status)
+	}
+	if cache.UpdateItemStatus("1", 123456, "unknown", 300) {
+		t.Error("Unknown rid should not be updated")
+	}
+}
+
+func TestCache_UpdateItemStatusDoesNotOverwriteNewerOrder(t *testing.T) {
+	cache := NewCache(2)
+	cache.SetOrder(newValidOrder("1"))
+
+	const versions = 2000
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for v := int64(1); v <= versions; v++ {
+			order := newValidOrder("1")
+			order.Version = v
+			cache.SetOrder(order)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < versions; i++ {
+			cache.UpdateItemStatus("1", 123456, "", 300+i%2)
+		}
+	}()
+	wg.Wait()
+
+	// Последняя запись заказа не должна быть затёрта копией предыдущей версии
+	order, _ := cache.GetOrder("1")
+	if order.Version != versions {
+		t.Errorf("Expected latest version %v in cache, got %v", versions, order.Version)
+	}
+}
+
 func TestCache_ConcurrentAccess(t *testing.T) {
 	cache := NewCache(100)
 	var wg sync.WaitGroup
@@ -185,6 +314,29 @@ func TestCache_ConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestCache_SetOrderIfUnchanged(t *testing.T) {
+	cache := NewCache(5)
+	order := newValidOrder("test-uid")
+
+	// Заказ удалён, пока читался из БД: прочитанная копия в кэш не попадает
+	generation := cache.Generation(order.OrderUID)
+	cache.DeleteOrder(order.OrderUID)
+	if cache.SetOrderIfUnchanged(order, generation) {
+		t.Error("Order deleted after the generation was taken must not be cached")
+	}
+	if _, ok := cache.GetOrder(order.OrderUID); ok {
+		t.Error("Deleted order must not reappear in cache")
+	}
+
+	generation = cache.Generation(order.OrderUID)
+	if !cache.SetOrderIfUnchanged(order, generation) {
+		t.Error("Unchanged order should be cached")
+	}
+	if _, ok := cache.GetOrder(order.OrderUID); !ok {
+		t.Error("Expected order to be cached")
+	}
+}
+
 func TestCache_GetOrder_NotFound(t *testing.T) {
 	cache := NewCache(5)
 	_, ok := cache.GetOrder("nonexistent")
@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"l0/internal/model"
 	"testing"
 	"time"
@@ -9,15 +11,32 @@ import (
 
 
 type MockOrderStore struct {
-	saveOrderFn      func(ctx context.Context, ord model.Order) error
+	saveOrderFn      func(ctx context.Context, ord model.Order, refs ...MessageRef) error
+	saveOrdersFn     func(ctx context.Context, orders []model.Order, refs []MessageRef) ([]SaveStatus, error)
+	deleteOrderFn    func(ctx context.Context, orderUID string, version int64, refs ...MessageRef) error
 	getOrderByIDFn   func(ctx context.Context, orderUID string) (*model.Order, error)
 	getAllOrdersFn   func(ctx context.Context) (map[string]model.Order, error)
 	getLastThreeFn   func(ctx context.Context) (map[string]model.Order, error)
+	iterateOrdersFn  func(ctx context.Context, filter OrderFilter, fn func(model.Order) error) error
 }
 
-func (m *MockOrderStore) SaveOrder(ctx context.Context, ord model.Order) error {
+func (m *MockOrderStore) SaveOrder(ctx context.Context, ord model.Order, refs ...MessageRef) error {
 	if m.saveOrderFn != nil {
-		return m.saveOrderFn(ctx, ord)
+		return m.saveOrderFn(ctx, ord, refs...)
+	}
+	return nil
+}
+
+func (m *MockOrderStore) SaveOrders(ctx context.Context, orders []model.Order, refs []MessageRef) ([]SaveStatus, error) {
+	if m.saveOrdersFn != nil {
+		return m.saveOrdersFn(ctx, orders, refs)
+	}
+	return make([]SaveStatus, len(orders)), nil
+}
+
+func (m *MockOrderStore) DeleteOrder(ctx context.Context, orderUID string, version int64, refs ...MessageRef) error {
+	if m.deleteOrderFn != nil {
+		return m.deleteOrderFn(ctx, orderUID, version, refs...)
 	}
 	return nil
 }
@@ -36,6 +55,17 @@ func (m *MockOrderStore) GetAllOrders(ctx context.Context) (map[string]model.Ord
 	return map[string]model.Order{}, nil
 }
 
+func (m *MockOrderStore) IterateOrders(ctx context.Context, filter OrderFilter, fn func(model.Order) error) error {
+	if m.iterateOrdersFn != nil {
+		return m.iterateOrdersFn(ctx, filter, fn)
+	}
+	return nil
+}
+
+func (m *MockOrderStore) ForgetMessages(ctx context.Context, topic string, partition int, from, to int64) (int64, error) {
+	return 0, nil
+}
+
 func (m *MockOrderStore) GetLastThreeOrders(ctx context.Context) (map[string]model.Order, error) {
 	if m.getLastThreeFn != nil {
 		return m.getLastThreeFn(ctx)
@@ -99,7 +129,7 @@ func newValidOrder(uid string) model.Order {
 func TestMockOrderStore_SaveOrder(t *testing.T) {
 	called := false
 	mock := &MockOrderStore{
-		saveOrderFn: func(ctx context.Context, ord model.Order) error {
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...MessageRef) error {
 			called = true
 			if ord.OrderUID != "test-123" {
 				t.Errorf("Expected OrderUID 'test-123', got %s", ord.OrderUID)
@@ -160,6 +190,227 @@ func TestMockOrderStore_GetAllOrders(t *testing.T) {
 	}
 }
 
+func TestLatestOrders_KeepsNewestVersion(t *testing.T) {
+	newer := newValidOrder("dup")
+	newer.Version = 2
+	older := newValidOrder("dup")
+	older.Version = 1
+	orders := []model.Order{newer, newValidOrder("other"), older}
+	statuses := make([]SaveStatus, len(orders))
+
+	indexes := latestOrders(orders, statuses)
+
+	if len(indexes) != 2 || indexes[0] != 0 || indexes[1] != 1 {
+		t.Fatalf("Expected indexes [0 1], got %v", indexes)
+	}
+	if statuses[2] != StatusStale {
+		t.Errorf("Older version in the same batch should be stale, got %v", statuses[2])
+	}
+}
+
+func TestLatestOrders_SkipsDuplicatesAndPrefersFirstOnTie(t *testing.T) {
+	orders := []model.Order{newValidOrder("a"), newValidOrder("a"), newValidOrder("b")}
+	statuses := []SaveStatus{StatusSaved, StatusSaved, StatusDuplicate}
+
+	indexes := latestOrders(orders, statuses)
+
+	// Та же версия не новее уже записанной, поэтому второй заказ устарел
+	if len(indexes) != 1 || indexes[0] != 0 {
+		t.Fatalf("Expected only index 0, got %v", indexes)
+	}
+	if statuses[1] != StatusStale || statuses[2] != StatusDuplicate {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+}
+
+func TestBuried_RejectsVersionsUpToTombstone(t *testing.T) {
+	tombstones := map[string]int64{"gone": 5}
+
+	for version, want := range map[int64]bool{4: true, 5: true, 6: false} {
+		ord := newValidOrder("gone")
+		ord.Version = version
+		if got := buried(tombstones, ord); got != want {
+			t.Errorf("Version %v against tombstone 5: expected buried=%v, got %v", version, want, got)
+		}
+	}
+	if buried(tombstones, newValidOrder("alive")) {
+		t.Error("Order without tombstone must not be buried")
+	}
+}
+
+func TestItemCopyRows_KeepsItemsPerOrder(t *testing.T) {
+	a := newValidOrder("a")
+	a.Items = append(a.Items, a.Items[0], a.Items[0])
+	a.Items[1].Price = 2.0
+	a.Items[2].RID = "other-line"
+	a.Items[2].Price = 3.0
+	b := newValidOrder("b")
+	b.Items[0].ChrtID = a.Items[0].ChrtID
+	b.Items[0].Price = 1.0
+
+	items := itemCopyRows([]model.Order{a, b})
+
+	// Повтор rid внутри заказа схлопывается, тот же chrt_id с другим rid или в другом
+	// заказе — отдельная строка
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 item rows, got %d", len(items))
+	}
+	if items[0][0] != "a" || items[0][3] != 2.0 {
+		t.Errorf("Expected last version of the first line of order a with price 2.0, got %v", items[0])
+	}
+	if items[1][0] != "a" || items[1][4] != "other-line" || items[1][3] != 3.0 {
+		t.Errorf("Second line of order a must be kept with price 3.0, got %v", items[1])
+	}
+	if items[2][0] != "b" || items[2][3] != 1.0 {
+		t.Errorf("Order b must keep its own price 1.0, got %v", items[2])
+	}
+}
+
+func TestOrderSet_AttachesPartsByUID(t *testing.T) {
+	set := newOrderSet()
+	set.add(model.Order{OrderUID: "b"})
+	set.add(model.Order{OrderUID: "a"})
+
+	if uids := set.uids(); len(uids) != 2 || uids[0] != "b" || uids[1] != "a" {
+		t.Fatalf("Expected uids in load order [b a], got %v", uids)
+	}
+
+	set.get("a").Items = append(set.get("a").Items, model.Item{ChrtID: 1})
+	set.get("a").Items = append(set.get("a").Items, model.Item{ChrtID: 2})
+	set.get("b").Delivery.City = "Moscow"
+	if set.get("unknown") != nil {
+		t.Error("Unknown order_uid must not be found")
+	}
+
+	if len(set.orders[1].Items) != 2 || len(set.orders[0].Items) != 0 || set.orders[0].Delivery.City != "Moscow" {
+		t.Errorf("Parts attached to wrong orders: %+v", set.orders)
+	}
+	if m := ordersByUID(set.orders); len(m) != 2 || len(m["a"].Items) != 2 {
+		t.Errorf("Unexpected orders map: %+v", m)
+	}
+}
+
+func TestOrderFilter_Where(t *testing.T) {
+	where, args := OrderFilter{}.where("")
+	if where != "WHERE order_uid > $1" || len(args) != 1 || args[0] != "" {
+		t.Errorf("Unexpected empty filter: %q %v", where, args)
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	where, args = OrderFilter{CreatedFrom: from, CustomerID: "c1"}.where("uid-9")
+	expected := "WHERE order_uid > $1 AND date_created >= $2 AND customer_id = $3"
+	if where != expected {
+		t.Errorf("Expected %q, got %q", expected, where)
+	}
+	if len(args) != 3 || args[0] != "uid-9" || args[1] != from || args[2] != "c1" {
+		t.Errorf("Unexpected args: %v", args)
+	}
+}
+
+// Порции из отсортированного списка order_uid так же, как их отдаёт keyset-запрос
+func pagesOf(uids []string, cursors *[]string) func(afterUID string, limit int) ([]model.Order, error) {
+	return func(afterUID string, limit int) ([]model.Order, error) {
+		*cursors = append(*cursors, afterUID)
+		var page []model.Order
+		for _, uid := range uids {
+			if uid > afterUID && len(page) < limit {
+				page = append(page, model.Order{OrderUID: uid})
+			}
+		}
+		return page, nil
+	}
+}
+
+func TestIterateOrderPages_VisitsEveryOrderOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		uids    []string
+		cursors []string
+	}{
+		{"short last page", []string{"a", "b", "c", "d", "e", "f", "g"}, []string{"", "c", "f"}},
+		{"full last page", []string{"a", "b", "c", "d", "e", "f"}, []string{"", "c", "f"}},
+		{"single short page", []string{"a", "b"}, []string{""}},
+		{"no orders", nil, []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cursors, visited []string
+			err := iterateOrderPages(3, pagesOf(tt.uids, &cursors), func(ord model.Order) error {
+				visited = append(visited, ord.OrderUID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Курсор сдвигается на последний order_uid порции, неполная порция завершает обход
+			if len(cursors) != len(tt.cursors) {
+				t.Fatalf("Expected cursors %v, got %v", tt.cursors, cursors)
+			}
+			for i := range cursors {
+				if cursors[i] != tt.cursors[i] {
+					t.Errorf("Expected cursors %v, got %v", tt.cursors, cursors)
+					break
+				}
+			}
+
+			// На границах порций заказы не пропускаются и не повторяются
+			if len(visited) != len(tt.uids) {
+				t.Fatalf("Expected orders %v, got %v", tt.uids, visited)
+			}
+			for i := range visited {
+				if visited[i] != tt.uids[i] {
+					t.Errorf("Expected orders %v, got %v", tt.uids, visited)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestIterateOrderPages_StopsOnError(t *testing.T) {
+	stop := errors.New("stop")
+	var cursors []string
+	visited := 0
+	err := iterateOrderPages(2, pagesOf([]string{"a", "b", "c", "d", "e"}, &cursors), func(ord model.Order) error {
+		visited++
+		if ord.OrderUID == "c" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Expected error from fn to be returned as is, got %v", err)
+	}
+	if visited != 3 || len(cursors) != 2 {
+		t.Errorf("Iteration must stop at order c, visited %v orders with cursors %v", visited, cursors)
+	}
+
+	loadErr := errors.New("load failed")
+	err = iterateOrderPages(2, func(afterUID string, limit int) ([]model.Order, error) {
+		return nil, loadErr
+	}, func(ord model.Order) error {
+		t.Error("fn must not be called when a page fails to load")
+		return nil
+	})
+	if err != loadErr {
+		t.Errorf("Expected page load error, got %v", err)
+	}
+}
+
+func TestMessageRef_Key(t *testing.T) {
+	byOffset := MessageRef{Topic: "orders", Partition: 1, Offset: 42}
+	if got := byOffset.key(); got != "orders/1/42" {
+		t.Errorf("Expected key orders/1/42, got %q", got)
+	}
+
+	byEvent := MessageRef{EventID: "evt-1", Topic: "orders", Partition: 1, Offset: 42}
+	if got := byEvent.key(); got != "event:evt-1" {
+		t.Errorf("Expected key event:evt-1, got %q", got)
+	}
+}
+
 type OrderService struct {
 	store OrderStore
 }
@@ -173,6 +424,27 @@ func (s *OrderService) ProcessOrder(ctx context.Context, uid string) error {
 	return err
 }
 
+func TestOrderAcceptedArgs(t *testing.T) {
+	acceptedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ord := model.Order{OrderUID: "order-1", TrackNumber: "WB1", CustomerID: "c1", Version: 7}
+
+	args, err := orderAcceptedArgs(ord, acceptedAt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if args[0] != EventOrderAccepted || args[1] != "order-1" {
+		t.Errorf("Unexpected event type or key: %v, %v", args[0], args[1])
+	}
+
+	var event model.OrderAccepted
+	if err := json.Unmarshal(args[2].([]byte), &event); err != nil {
+		t.Fatalf("Payload is not valid JSON: %v", err)
+	}
+	if event.OrderUID != "order-1" || event.Version != 7 || !event.AcceptedAt.Equal(acceptedAt) {
+		t.Errorf("Unexpected payload: %+v", event)
+	}
+}
+
 func TestOrderService_WithMock(t *testing.T) {
 	mock := &MockOrderStore{
 		getOrderByIDFn: func(ctx context.Context, uid string) (*model.Order, error) {
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Типизированные ошибки репозиториев. Исходная ошибка драйвера остаётся в цепочке,
+// поэтому errors.Is/As работают и для сентинелов, и для *pgconn.PgError
+var (
+	// ErrNotFound — запрошенной записи нет
+	ErrNotFound = errors.New("not found")
+	// ErrConflict — запись нарушает ограничения целостности (уникальность, внешние ключи).
+	// Повтор того же запроса не поможет
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable — БД временно недоступна или транзакцию нужно повторить
+	// (обрыв соединения, таймаут пула, serialization failure, deadlock)
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// Коды ошибок Postgres, после которых имеет смысл повторить транзакцию
+var transientPgCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// Временная ли ошибка БД: уже помеченная ErrUnavailable, сетевые сбои, таймауты пула,
+// сериализация и дедлоки. Нарушения ограничений и прочие ошибки данных считаются постоянными
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Класс 08 — ошибки соединения
+		return transientPgCodes[pgErr.Code] || (len(pgErr.Code) == 5 && pgErr.Code[:2] == "08")
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
+
+// Класс 23 — нарушения ограничений целостности
+func isConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && len(pgErr.Code) == 5 && pgErr.Code[:2] == "23"
+}
+
+// Оборачивание ошибки драйвера в ErrNotFound, ErrConflict или ErrUnavailable.
+// Уже типизированные ошибки и ошибки, не относящиеся к БД, возвращаются как есть
+func classify(err error) error {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrNotFound), errors.Is(err, ErrConflict), errors.Is(err, ErrUnavailable):
+		return err
+	case errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case isConstraintViolation(err):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case IsUnavailable(err):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// Классификация ошибки, возвращаемой методом репозитория: defer classifyErr(&err)
+func classifyErr(err *error) {
+	*err = classify(*err)
+}
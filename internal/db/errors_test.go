@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no rows", fmt.Errorf("failed to get order: %w", pgx.ErrNoRows), ErrNotFound},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ErrConflict},
+		{"foreign key violation", fmt.Errorf("failed to save item: %w", &pgconn.PgError{Code: "23503"}), ErrConflict},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, ErrUnavailable},
+		{"connection exception", &pgconn.PgError{Code: "08006"}, ErrUnavailable},
+		{"pool timeout", fmt.Errorf("failed to begin transaction: %w", context.DeadlineExceeded), ErrUnavailable},
+		{"item not found", ErrItemNotFound, ErrNotFound},
+		{"quarantined message not found", ErrNotQuarantined, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		if got := classify(tt.err); !errors.Is(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestClassify_KeepsOriginalError(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "23505"}
+	err := classify(fmt.Errorf("failed to save order: %w", pgErr))
+
+	var got *pgconn.PgError
+	if !errors.As(err, &got) || got != pgErr {
+		t.Errorf("Driver error must stay in the chain, got %v", err)
+	}
+	if classify(err) != err {
+		t.Error("Already classified error must be returned as is")
+	}
+}
+
+func TestClassify_PassesThroughOtherErrors(t *testing.T) {
+	for _, err := range []error{nil, ErrDuplicate, ErrStale, context.Canceled, &pgconn.PgError{Code: "22P02"}} {
+		if got := classify(err); got != err {
+			t.Errorf("Expected %v unchanged, got %v", err, got)
+		}
+	}
+}
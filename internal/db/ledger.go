@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"l0/internal/model"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrDuplicate — сообщение уже было обработано, заказ не перезаписывается
+	ErrDuplicate = errors.New("message already processed")
+	// ErrStale — в БД уже более новая версия заказа
+	ErrStale = errors.New("stored order version is newer")
+)
+
+// Статус заказа после пакетного сохранения
+type SaveStatus int
+
+const (
+	StatusSaved     SaveStatus = iota
+	StatusDuplicate            // сообщение уже было обработано
+	StatusStale                // в БД или в той же пачке более новая версия
+)
+
+// Ссылка на сообщение Kafka для журнала обработанных сообщений.
+// Если продюсер передал ID события, дубликаты ищутся по нему, иначе по topic/partition/offset
+type MessageRef struct {
+	EventID   string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+func (m MessageRef) key() string {
+	if m.EventID != "" {
+		return "event:" + m.EventID
+	}
+	return m.Topic + "/" + strconv.Itoa(m.Partition) + "/" + strconv.FormatInt(m.Offset, 10)
+}
+
+const insertProcessedMessageSQL = `
+        INSERT INTO processed_messages (
+            message_key, topic, kafka_partition, kafka_offset, order_uid
+        ) VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (message_key) DO NOTHING
+    `
+
+// Запись сообщения в журнал внутри транзакции заказа. false — сообщение уже было в журнале
+func recordMessage(ctx context.Context, tx pgx.Tx, ref MessageRef, orderUID string) (bool, error) {
+	tag, err := tx.Exec(ctx, insertProcessedMessageSQL,
+		ref.key(), ref.Topic, ref.Partition, ref.Offset, orderUID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record processed message: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Запись пачки сообщений в журнал одним pgx.Batch. Возвращает, какие из них новые
+func recordMessages(ctx context.Context, tx pgx.Tx, refs []MessageRef, orders []model.Order) ([]bool, error) {
+	batch := &pgx.Batch{}
+	for i, ref := range refs {
+		batch.Queue(insertProcessedMessageSQL, ref.key(), ref.Topic, ref.Partition, ref.Offset, orders[i].OrderUID)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
+
+	fresh := make([]bool, len(refs))
+	for i := range refs {
+		tag, err := results.Exec()
+		if err != nil {
+			return nil, fmt.Errorf("failed to record processed message: %w", err)
+		}
+		fresh[i] = tag.RowsAffected() == 1
+	}
+	return fresh, nil
+}
+
+// Удаление из журнала сообщений партиции со смещениями в [from, to). После сброса
+// смещений группы назад эти сообщения читаются снова и должны быть обработаны,
+// а не пропущены как дубликаты. Возвращает число удалённых записей
+func (r *OrderRepository) ForgetMessages(ctx context.Context, topic string, partition int, from, to int64) (_ int64, err error) {
+	defer classifyErr(&err)
+
+	tag, err := r.db.conn().Exec(ctx, `
+        DELETE FROM processed_messages
+        WHERE topic = $1 AND kafka_partition = $2 AND kafka_offset >= $3 AND kafka_offset < $4
+    `, topic, partition, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to forget processed messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("Failed to open embedded migrations: %v", err)
+	}
+	migrations, err := loadMigrations(sub)
+	if err != nil {
+		t.Fatalf("Embedded migrations must load: %v", err)
+	}
+
+	// Версии идут подряд с 1, чтобы новые миграции не вставали между уже применёнными
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("Expected version %v at position %v, got %v_%v", i+1, i, m.Version, m.Name)
+		}
+	}
+
+	// Все таблицы, с которыми работают репозитории, создаются миграциями
+	var up strings.Builder
+	for _, m := range migrations {
+		up.WriteString(m.Up)
+	}
+	for _, table := range []string{"orders", "delivery", "payments", "items", "order_items",
+		"processed_messages", "outbox", "quarantine", "order_tombstones"} {
+		if !strings.Contains(up.String(), "CREATE TABLE IF NOT EXISTS "+table+" (") {
+			t.Errorf("No migration creates table %v", table)
+		}
+	}
+}
+
+func TestLoadMigrations_SortsAndPairs(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	})
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 2 {
+		t.Fatalf("Unexpected migrations: %+v", migrations)
+	}
+	if migrations[0].Up != "CREATE TABLE a ();" || migrations[0].Down != "DROP TABLE a;" {
+		t.Errorf("Up and down must be paired by version: %+v", migrations[0])
+	}
+}
+
+func TestLoadMigrations_Errors(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad file name": {
+			"first.sql": {Data: []byte("SELECT 1;")},
+		},
+		"name mismatch": {
+			"0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS delivery;
+DROP TABLE IF EXISTS orders;
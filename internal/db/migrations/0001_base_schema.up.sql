@@ -0,0 +1,63 @@
+-- Заказы, доставка, оплата и товары. IF NOT EXISTS позволяет принять под управление
+-- миграций базу, в которой таблицы уже созданы вручную
+CREATE TABLE IF NOT EXISTS orders (
+    order_uid          TEXT PRIMARY KEY,
+    track_number       TEXT NOT NULL,
+    entry              TEXT NOT NULL,
+    locale             TEXT NOT NULL,
+    internal_signature TEXT NOT NULL,
+    customer_id        TEXT NOT NULL,
+    delivery_service   TEXT NOT NULL,
+    shardkey           TEXT NOT NULL,
+    sm_id              INT NOT NULL,
+    date_created       TIMESTAMPTZ NOT NULL,
+    oof_shard          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_date_created_idx ON orders (date_created DESC);
+
+CREATE TABLE IF NOT EXISTS delivery (
+    order_uid TEXT PRIMARY KEY REFERENCES orders (order_uid),
+    name      TEXT NOT NULL,
+    phone     TEXT NOT NULL,
+    zip       TEXT NOT NULL,
+    city      TEXT NOT NULL,
+    address   TEXT NOT NULL,
+    region    TEXT NOT NULL,
+    email     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    transaction   TEXT PRIMARY KEY,
+    order_uid     TEXT NOT NULL REFERENCES orders (order_uid),
+    request_id    TEXT NOT NULL,
+    currency      TEXT NOT NULL,
+    provider      TEXT NOT NULL,
+    amount        NUMERIC NOT NULL,
+    payment_dt    BIGINT NOT NULL,
+    bank          TEXT NOT NULL,
+    delivery_cost NUMERIC NOT NULL,
+    goods_total   INT NOT NULL,
+    custom_fee    NUMERIC NOT NULL
+);
+CREATE INDEX IF NOT EXISTS payments_order_uid_idx ON payments (order_uid);
+
+CREATE TABLE IF NOT EXISTS items (
+    chrt_id      BIGINT PRIMARY KEY,
+    track_number TEXT NOT NULL,
+    price        NUMERIC NOT NULL,
+    rid          TEXT NOT NULL,
+    name         TEXT NOT NULL,
+    sale         NUMERIC NOT NULL,
+    size         TEXT NOT NULL,
+    total_price  NUMERIC NOT NULL,
+    nm_id        BIGINT NOT NULL,
+    brand        TEXT NOT NULL,
+    status       INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_uid TEXT NOT NULL REFERENCES orders (order_uid),
+    chrt_id   BIGINT NOT NULL REFERENCES items (chrt_id),
+    PRIMARY KEY (order_uid, chrt_id)
+);
+CREATE INDEX IF NOT EXISTS order_items_chrt_id_idx ON order_items (chrt_id);
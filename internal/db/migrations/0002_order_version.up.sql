@@ -0,0 +1,2 @@
+-- Версия события заказа: более старые версии не перезаписывают заказ
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Журнал обработанных сообщений для распознавания повторных доставок
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_key     TEXT PRIMARY KEY,
+    topic           TEXT NOT NULL,
+    kafka_partition INT NOT NULL,
+    kafka_offset    BIGINT NOT NULL,
+    order_uid       TEXT NOT NULL,
+    processed_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- Время последней смены статуса товара: более старые события статуса пропускаются
+ALTER TABLE items ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
@@ -0,0 +1,16 @@
+-- Карантин сообщений, которые консьюмер не смог обработать
+CREATE TABLE IF NOT EXISTS quarantine (
+    id              BIGSERIAL PRIMARY KEY,
+    topic           TEXT NOT NULL,
+    kafka_partition INT NOT NULL,
+    kafka_offset    BIGINT NOT NULL,
+    message_key     BYTEA,
+    payload         BYTEA,
+    headers         JSONB NOT NULL DEFAULT '[]',
+    error_class     TEXT NOT NULL,
+    error           TEXT NOT NULL,
+    attempts        INT NOT NULL DEFAULT 1,
+    first_seen      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (topic, kafka_partition, kafka_offset)
+);
@@ -0,0 +1,41 @@
+-- Возврат к общим товарам со связями order_items. Откат с потерями: из копий одного
+-- chrt_id в разных заказах остаётся та, у которой статус менялся последним
+CREATE TEMP TABLE line_items_merge ON COMMIT DROP AS
+SELECT * FROM items;
+
+DROP TABLE items;
+
+CREATE TABLE items (
+    chrt_id           BIGINT PRIMARY KEY,
+    track_number      TEXT NOT NULL,
+    price             NUMERIC NOT NULL,
+    rid               TEXT NOT NULL,
+    name              TEXT NOT NULL,
+    sale              NUMERIC NOT NULL,
+    size              TEXT NOT NULL,
+    total_price       NUMERIC NOT NULL,
+    nm_id             BIGINT NOT NULL,
+    brand             TEXT NOT NULL,
+    status            INT NOT NULL,
+    status_changed_at TIMESTAMPTZ
+);
+
+INSERT INTO items (
+    chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status, status_changed_at
+)
+SELECT DISTINCT ON (chrt_id)
+       chrt_id, track_number, price, rid, name, sale, size,
+       total_price, nm_id, brand, status, status_changed_at
+FROM line_items_merge
+ORDER BY chrt_id, status_changed_at DESC NULLS LAST;
+
+CREATE TABLE order_items (
+    order_uid TEXT NOT NULL REFERENCES orders (order_uid),
+    chrt_id   BIGINT NOT NULL REFERENCES items (chrt_id),
+    PRIMARY KEY (order_uid, chrt_id)
+);
+CREATE INDEX order_items_chrt_id_idx ON order_items (chrt_id);
+
+INSERT INTO order_items (order_uid, chrt_id)
+SELECT order_uid, chrt_id FROM line_items_merge;
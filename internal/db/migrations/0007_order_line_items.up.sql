@@ -0,0 +1,38 @@
+-- Товары принадлежат заказу: ключ (order_uid, chrt_id) вместо общего chrt_id, поэтому
+-- заказ с тем же товаром больше не перезаписывает цену, скидку и статус в чужих заказах.
+-- Общие строки items разносятся копией в каждый заказ, который на них ссылался;
+-- товары без заказов не переносятся
+CREATE TEMP TABLE line_items_split ON COMMIT DROP AS
+SELECT oi.order_uid, i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size,
+       i.total_price, i.nm_id, i.brand, i.status, i.status_changed_at
+FROM order_items oi
+JOIN items i ON i.chrt_id = oi.chrt_id;
+
+DROP TABLE order_items;
+DROP TABLE items;
+
+CREATE TABLE items (
+    order_uid         TEXT NOT NULL REFERENCES orders (order_uid),
+    chrt_id           BIGINT NOT NULL,
+    track_number      TEXT NOT NULL,
+    price             NUMERIC NOT NULL,
+    rid               TEXT NOT NULL,
+    name              TEXT NOT NULL,
+    sale              NUMERIC NOT NULL,
+    size              TEXT NOT NULL,
+    total_price       NUMERIC NOT NULL,
+    nm_id             BIGINT NOT NULL,
+    brand             TEXT NOT NULL,
+    status            INT NOT NULL,
+    status_changed_at TIMESTAMPTZ,
+    PRIMARY KEY (order_uid, chrt_id)
+);
+CREATE INDEX items_chrt_id_idx ON items (chrt_id);
+
+INSERT INTO items (
+    order_uid, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status, status_changed_at
+)
+SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+       total_price, nm_id, brand, status, status_changed_at
+FROM line_items_split;
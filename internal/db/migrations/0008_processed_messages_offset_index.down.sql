@@ -0,0 +1 @@
+DROP INDEX IF EXISTS processed_messages_offset_idx;
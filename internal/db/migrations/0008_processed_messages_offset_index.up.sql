@@ -0,0 +1,3 @@
+-- Поиск записей журнала по смещениям партиции при сбросе смещений группы
+CREATE INDEX IF NOT EXISTS processed_messages_offset_idx
+    ON processed_messages (topic, kafka_partition, kafka_offset);
@@ -0,0 +1,15 @@
+-- Откат с потерями: из строк заказа с одним chrt_id остаётся та, у которой статус
+-- менялся последним
+DELETE FROM items
+WHERE ctid IN (
+    SELECT ctid FROM (
+        SELECT ctid, row_number() OVER (
+            PARTITION BY order_uid, chrt_id ORDER BY status_changed_at DESC NULLS LAST, rid
+        ) AS n
+        FROM items
+    ) ranked
+    WHERE n > 1
+);
+
+ALTER TABLE items DROP CONSTRAINT items_pkey;
+ALTER TABLE items ADD PRIMARY KEY (order_uid, chrt_id);
@@ -0,0 +1,17 @@
+-- Строка заказа определяется rid, а не chrt_id: один товар может встречаться в заказе
+-- несколькими строками с разными rid (цена, скидка, статус), а ключ (order_uid, chrt_id)
+-- склеивал их в одну. Если в заказе уже есть строки с одинаковым rid, остаётся та,
+-- у которой статус менялся последним
+DELETE FROM items
+WHERE ctid IN (
+    SELECT ctid FROM (
+        SELECT ctid, row_number() OVER (
+            PARTITION BY order_uid, rid ORDER BY status_changed_at DESC NULLS LAST, chrt_id
+        ) AS n
+        FROM items
+    ) ranked
+    WHERE n > 1
+);
+
+ALTER TABLE items DROP CONSTRAINT items_pkey;
+ALTER TABLE items ADD PRIMARY KEY (order_uid, rid);
@@ -0,0 +1,7 @@
+-- Удалённые заказы и версия, с которой они удалены. Строка заказа удаляется вместе
+-- с версией, поэтому без этой таблицы опоздавший старый снимок восстановил бы заказ
+CREATE TABLE IF NOT EXISTS order_tombstones (
+    order_uid  TEXT PRIMARY KEY,
+    version    BIGINT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -4,36 +4,44 @@ import (
 	"context"
 	"fmt"
 	"l0/internal/model"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 type OrderStore interface {
-	SaveOrder(ctx context.Context, ord model.Order) error
+	SaveOrder(ctx context.Context, ord model.Order, refs ...MessageRef) error
+	SaveOrders(ctx context.Context, orders []model.Order, refs []MessageRef) ([]SaveStatus, error)
+	DeleteOrder(ctx context.Context, orderUID string, version int64, refs ...MessageRef) error
 	GetOrderByID(ctx context.Context, orderUID string) (*model.Order, error)
 	GetAllOrders(ctx context.Context) (map[string]model.Order, error)
+	IterateOrders(ctx context.Context, filter OrderFilter, fn func(model.Order) error) error
+	ForgetMessages(ctx context.Context, topic string, partition int, from, to int64) (int64, error)
 }
 
 type OrderRepository struct {
-	db *Postgres
+	db     *Postgres
+	outbox bool
 }
 
-func NewOrderRepository(db *Postgres) *OrderRepository {
-	return &OrderRepository{db: db}
+// outbox — писать вместе с заказом событие order.accepted в таблицу outbox.
+// Без relay события только копились бы, поэтому запись включается вместе с ним
+func NewOrderRepository(db *Postgres, outbox bool) *OrderRepository {
+	return &OrderRepository{db: db, outbox: outbox}
 }
 
-// Сохранение заказа со всеми внутренностями в транзакции
-func (r *OrderRepository) SaveOrder(ctx context.Context, ord model.Order) error {
-	tx, err := r.db.pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer tx.Rollback(ctx)
-
-	// Заказ
-	_, err = tx.Exec(ctx, `
+// Запросы на вставку/обновление частей заказа, общие для SaveOrder и SaveOrders.
+// Статус товара, уже изменённый событием order-status, снимок заказа не перезаписывает:
+// у снимка нет времени изменения статуса, и он мог быть отправлен раньше события.
+// Заказ обновляется, только если его версия новее сохранённой; повтор той же версии
+// ничего не меняет (повторные доставки отсекает журнал сообщений)
+const (
+	upsertOrderSQL = `
         INSERT INTO orders (
             order_uid, track_number, entry, locale, internal_signature, 
-            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
         ON CONFLICT (order_uid) DO UPDATE SET
             track_number = EXCLUDED.track_number,
             entry = EXCLUDED.entry,
@@ -44,16 +52,12 @@ func (r *OrderRepository) SaveOrder(ctx context.Context, ord model.Order) error
             shardkey = EXCLUDED.shardkey,
             sm_id = EXCLUDED.sm_id,
             date_created = EXCLUDED.date_created,
-            oof_shard = EXCLUDED.oof_shard
-    `,
-		ord.OrderUID, ord.TrackNumber, ord.Entry, ord.Locale, ord.InternalSignature,
-		ord.CustomerID, ord.DeliveryService, ord.Shardkey, ord.SMID, ord.DateCreated, ord.OofShard)
-	if err != nil {
-		return fmt.Errorf("failed to save order: %v", err)
-	}
+            oof_shard = EXCLUDED.oof_shard,
+            version = EXCLUDED.version
+        WHERE orders.version < EXCLUDED.version
+    `
 
-	// Доставка
-	_, err = tx.Exec(ctx, `
+	upsertDeliverySQL = `
         INSERT INTO delivery (
             order_uid, name, phone, zip, city, address, region, email
         ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -65,15 +69,9 @@ func (r *OrderRepository) SaveOrder(ctx context.Context, ord model.Order) error
             address = EXCLUDED.address,
             region = EXCLUDED.region,
             email = EXCLUDED.email
-    `,
-		ord.OrderUID, ord.Delivery.Name, ord.Delivery.Phone, ord.Delivery.Zip,
-		ord.Delivery.City, ord.Delivery.Address, ord.Delivery.Region, ord.Delivery.Email)
-	if err != nil {
-		return fmt.Errorf("failed to save delivery: %v", err)
-	}
+    `
 
-	// Оплата
-	_, err = tx.Exec(ctx, `
+	upsertPaymentSQL = `
         INSERT INTO payments (
             transaction, order_uid, request_id, currency, provider, amount, 
             payment_dt, bank, delivery_cost, goods_total, custom_fee
@@ -89,295 +87,742 @@ func (r *OrderRepository) SaveOrder(ctx context.Context, ord model.Order) error
             delivery_cost = EXCLUDED.delivery_cost,
             goods_total = EXCLUDED.goods_total,
             custom_fee = EXCLUDED.custom_fee
-    `,
-		ord.Payment.Transaction, ord.OrderUID, ord.Payment.RequestID, ord.Payment.Currency,
-		ord.Payment.Provider, ord.Payment.Amount, ord.Payment.PaymentDT,
-		ord.Payment.Bank, ord.Payment.DeliveryCost, ord.Payment.GoodsTotal, ord.Payment.CustomFee)
-	if err != nil {
-		return fmt.Errorf("failed to save payment: %v", err)
-	}
+    `
 
-	// Товары
-	for _, item := range ord.Items {
-		// Товар
-		_, err = tx.Exec(ctx, `
+	upsertItemSQL = `
             INSERT INTO items (
-                chrt_id, track_number, price, rid, name, sale, size, 
+                order_uid, chrt_id, track_number, price, rid, name, sale, size, 
                 total_price, nm_id, brand, status
-            ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-            ON CONFLICT (chrt_id) DO UPDATE SET
+            ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+            ON CONFLICT (order_uid, rid) DO UPDATE SET
+                chrt_id = EXCLUDED.chrt_id,
                 track_number = EXCLUDED.track_number,
                 price = EXCLUDED.price,
-                rid = EXCLUDED.rid,
                 name = EXCLUDED.name,
-              	sale = EXCLUDED.sale,
+                sale = EXCLUDED.sale,
                 size = EXCLUDED.size,
                 total_price = EXCLUDED.total_price,
                 nm_id = EXCLUDED.nm_id,
                 brand = EXCLUDED.brand,
-                status = EXCLUDED.status
-        `,
-			item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NMID, item.Brand, item.Status)
+                status = CASE WHEN items.status_changed_at IS NULL
+                    THEN EXCLUDED.status ELSE items.status END
+        `
+)
+
+// Сохранение заказа со всеми внутренностями в транзакции.
+// Если передана ссылка на сообщение, оно записывается в журнал в той же транзакции,
+// а для уже обработанного сообщения возвращается ErrDuplicate
+func (r *OrderRepository) SaveOrder(ctx context.Context, ord model.Order, refs ...MessageRef) (err error) {
+	defer classifyErr(&err)
+
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Журнал обработанных сообщений
+	for _, ref := range refs {
+		fresh, err := recordMessage(ctx, tx, ref, ord.OrderUID)
 		if err != nil {
-			return fmt.Errorf("failed to save item: %v", err)
+			return err
 		}
+		if !fresh {
+			return ErrDuplicate
+		}
+	}
 
-		// Связь с заказом
-		_, err = tx.Exec(ctx, `
-            INSERT INTO order_items (order_uid, chrt_id)
-            VALUES ($1, $2)
-            ON CONFLICT (order_uid, chrt_id) DO NOTHING
-        `, ord.OrderUID, item.ChrtID)
+	// Заказ, если он не удалён с версией не старше этой
+	tombstones, err := tombstoneVersions(ctx, tx, []string{ord.OrderUID})
+	if err != nil {
+		return err
+	}
+	saved := false
+	if !buried(tombstones, ord) {
+		tag, err := tx.Exec(ctx, upsertOrderSQL, orderArgs(ord)...)
 		if err != nil {
-			return fmt.Errorf("failed to save order-item relation: %v", err)
+			return fmt.Errorf("failed to save order: %w", err)
+		}
+		saved = tag.RowsAffected() > 0
+	}
+	if !saved {
+		// В БД более новая версия или заказ удалён: фиксируем только запись в журнале сообщений
+		if err = tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return ErrStale
+	}
+
+	// Доставка
+	_, err = tx.Exec(ctx, upsertDeliverySQL, deliveryArgs(ord)...)
+	if err != nil {
+		return fmt.Errorf("failed to save delivery: %w", err)
+	}
+
+	// Оплата
+	_, err = tx.Exec(ctx, upsertPaymentSQL, paymentArgs(ord)...)
+	if err != nil {
+		return fmt.Errorf("failed to save payment: %w", err)
+	}
+
+	// Товары: набор товаров заказа заменяется целиком, товары, которых нет
+	// в новой версии заказа, удаляются
+	rids := make([]string, len(ord.Items))
+	for i, item := range ord.Items {
+		rids[i] = item.RID
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM items WHERE order_uid = $1 AND rid <> ALL($2)`, ord.OrderUID, rids)
+	if err != nil {
+		return fmt.Errorf("failed to delete removed items: %w", err)
+	}
+	for _, item := range ord.Items {
+		_, err = tx.Exec(ctx, upsertItemSQL, itemArgs(ord.OrderUID, item)...)
+		if err != nil {
+			return fmt.Errorf("failed to save item: %w", err)
+		}
+	}
+
+	// Событие order.accepted публикуется relay только после коммита
+	if r.outbox {
+		if err = enqueueOrderAccepted(ctx, tx, ord); err != nil {
+			return err
 		}
 	}
 
 	// Коммит транзакции
 	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-// Получение заказа по ID
-func (r *OrderRepository) GetOrderByID(ctx context.Context, orderUID string) (*model.Order, error) {
-	// Получаем заказ
-	var ord model.Order
-	err := r.db.pool.QueryRow(ctx, `
-        SELECT order_uid, track_number, entry, locale, internal_signature, 
-               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        FROM orders
-        WHERE order_uid = $1
-    `, orderUID).Scan(
-		&ord.OrderUID, &ord.TrackNumber, &ord.Entry, &ord.Locale, &ord.InternalSignature,
-		&ord.CustomerID, &ord.DeliveryService, &ord.Shardkey, &ord.SMID, &ord.DateCreated, &ord.OofShard)
+// Сохранение пачки заказов в одной транзакции. Заказы, доставки и оплаты отправляются
+// через pgx.Batch, товары — через COPY во временную таблицу.
+// refs (если не nil) — ссылки на сообщения по одной на заказ. Возвращает статус
+// каждого заказа: записан, пропущен как дубликат сообщения или как устаревшая версия
+func (r *OrderRepository) SaveOrders(ctx context.Context, orders []model.Order, refs []MessageRef) (_ []SaveStatus, err error) {
+	defer classifyErr(&err)
+
+	statuses := make([]SaveStatus, len(orders))
+	if len(orders) == 0 {
+		return statuses, nil
+	}
+	if refs != nil && len(refs) != len(orders) {
+		return nil, fmt.Errorf("got %v message refs for %v orders", len(refs), len(orders))
+	}
+
+	tx, err := r.db.begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	// Получаем доставку
-	err = r.db.pool.QueryRow(ctx, `
-        SELECT name, phone, zip, city, address, region, email
-        FROM delivery
-        WHERE order_uid = $1
-    `, orderUID).Scan(
-		&ord.Delivery.Name, &ord.Delivery.Phone, &ord.Delivery.Zip,
-		&ord.Delivery.City, &ord.Delivery.Address, &ord.Delivery.Region, &ord.Delivery.Email)
+	// Журнал обработанных сообщений: дальше идут только новые
+	if refs != nil {
+		fresh, err := recordMessages(ctx, tx, refs, orders)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fresh {
+			if !fresh[i] {
+				statuses[i] = StatusDuplicate
+			}
+		}
+	}
+
+	// Заказы: обновление проходит только для версий новее сохранённых
+	// и новее версии, с которой заказ удалён
+	candidates := latestOrders(orders, statuses)
+	uids := make([]string, len(candidates))
+	for k, i := range candidates {
+		uids[k] = orders[i].OrderUID
+	}
+	tombstones, err := tombstoneVersions(ctx, tx, uids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get delivery: %v", err)
+		return nil, err
+	}
+	alive := candidates[:0]
+	for _, i := range candidates {
+		if buried(tombstones, orders[i]) {
+			statuses[i] = StatusStale
+			continue
+		}
+		alive = append(alive, i)
+	}
+	candidates = alive
+	batch := &pgx.Batch{}
+	for _, i := range candidates {
+		batch.Queue(upsertOrderSQL, orderArgs(orders[i])...)
+	}
+	results := tx.SendBatch(ctx, batch)
+	winners := make([]model.Order, 0, len(candidates))
+	for _, i := range candidates {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to save order %v: %w", orders[i].OrderUID, err)
+		}
+		if tag.RowsAffected() == 0 {
+			statuses[i] = StatusStale
+			continue
+		}
+		winners = append(winners, orders[i])
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close batch: %w", err)
 	}
 
-	// Получаем оплату
-	err = r.db.pool.QueryRow(ctx, `
-        SELECT transaction, request_id, currency, provider, amount, 
-               payment_dt, bank, delivery_cost, goods_total, custom_fee
-        FROM payments
-        WHERE order_uid = $1
-    `, orderUID).Scan(
-		&ord.Payment.Transaction, &ord.Payment.RequestID, &ord.Payment.Currency,
-		&ord.Payment.Provider, &ord.Payment.Amount, &ord.Payment.PaymentDT,
-		&ord.Payment.Bank, &ord.Payment.DeliveryCost, &ord.Payment.GoodsTotal, &ord.Payment.CustomFee)
+	if len(winners) == 0 {
+		if err = tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return statuses, nil
+	}
+	orders = winners
+
+	// Доставки, оплаты и события order.accepted в outbox
+	acceptedAt := time.Now().UTC()
+	batch = &pgx.Batch{}
+	for _, ord := range orders {
+		batch.Queue(upsertDeliverySQL, deliveryArgs(ord)...)
+		batch.Queue(upsertPaymentSQL, paymentArgs(ord)...)
+		if r.outbox {
+			outboxArgs, err := orderAcceptedArgs(ord, acceptedAt)
+			if err != nil {
+				return nil, err
+			}
+			batch.Queue(insertOutboxSQL, outboxArgs...)
+		}
+	}
+	perOrder := batch.Len() / len(orders)
+	results = tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to save order %v: %w", orders[i/perOrder].OrderUID, err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close batch: %w", err)
+	}
+
+	// Товары: COPY во временную таблицу, удаление товаров, которых нет в новых
+	// версиях заказов, и перенос с ON CONFLICT
+	itemRows := itemCopyRows(orders)
+	uids = make([]string, len(orders))
+	for i, ord := range orders {
+		uids[i] = ord.OrderUID
+	}
+
+	_, err = tx.Exec(ctx, `
+        CREATE TEMP TABLE items_stage (LIKE items INCLUDING DEFAULTS) ON COMMIT DROP
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create items stage: %w", err)
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"items_stage"}, []string{
+		"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+		"total_price", "nm_id", "brand", "status",
+	}, pgx.CopyFromRows(itemRows))
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy items: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+        DELETE FROM items i
+        WHERE i.order_uid = ANY($1)
+          AND NOT EXISTS (
+              SELECT 1 FROM items_stage s
+              WHERE s.order_uid = i.order_uid AND s.rid = i.rid
+          )
+    `, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete removed items: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO items (
+            order_uid, chrt_id, track_number, price, rid, name, sale, size, 
+            total_price, nm_id, brand, status
+        )
+        SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, 
+               total_price, nm_id, brand, status
+        FROM items_stage
+        ON CONFLICT (order_uid, rid) DO UPDATE SET
+            chrt_id = EXCLUDED.chrt_id,
+            track_number = EXCLUDED.track_number,
+            price = EXCLUDED.price,
+            name = EXCLUDED.name,
+            sale = EXCLUDED.sale,
+            size = EXCLUDED.size,
+            total_price = EXCLUDED.total_price,
+            nm_id = EXCLUDED.nm_id,
+            brand = EXCLUDED.brand,
+            status = CASE WHEN items.status_changed_at IS NULL
+                THEN EXCLUDED.status ELSE items.status END
+    `)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get payment: %v", err)
+		return nil, fmt.Errorf("failed to save items: %w", err)
 	}
 
-	// Получаем товары
-	rows, err := r.db.pool.Query(ctx, `
-        SELECT i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, 
-               i.total_price, i.nm_id, i.brand, i.status
-        FROM items i
-        JOIN order_items oi ON i.chrt_id = oi.chrt_id
-        WHERE oi.order_uid = $1
-    `, orderUID)
+	// Коммит транзакции
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// Удаление заказа вместе с доставкой, оплатой и товарами. Удаление несуществующего
+// заказа не ошибка. version — версия tombstone-сообщения, 0 — без версии: тогда
+// заказ считается удалённым с его сохранённой версией
+func (r *OrderRepository) DeleteOrder(ctx context.Context, orderUID string, version int64, refs ...MessageRef) (err error) {
+	defer classifyErr(&err)
+
+	tx, err := r.db.begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get items: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	for rows.Next() {
-		var item model.Item
-		if err := rows.Scan(
-			&item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
-			&item.Sale, &item.Size, &item.TotalPrice, &item.NMID, &item.Brand, &item.Status,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan item: %v", err)
+	// Журнал обработанных сообщений
+	for _, ref := range refs {
+		fresh, err := recordMessage(ctx, tx, ref, orderUID)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrDuplicate
 		}
-		ord.Items = append(ord.Items, item)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating items: %v", err)
+	// Товары
+	if _, err = tx.Exec(ctx, `DELETE FROM items WHERE order_uid = $1`, orderUID); err != nil {
+		return fmt.Errorf("failed to delete items: %w", err)
+	}
+
+	// Доставка
+	if _, err = tx.Exec(ctx, `DELETE FROM delivery WHERE order_uid = $1`, orderUID); err != nil {
+		return fmt.Errorf("failed to delete delivery: %w", err)
+	}
+
+	// Оплата
+	if _, err = tx.Exec(ctx, `DELETE FROM payments WHERE order_uid = $1`, orderUID); err != nil {
+		return fmt.Errorf("failed to delete payment: %w", err)
+	}
+
+	// Tombstone: версия удаления — наибольшая из версии tombstone-сообщения,
+	// сохранённой версии заказа и прежнего удаления. Снимки не новее неё заказ
+	// не восстанавливают
+	_, err = tx.Exec(ctx, `
+        INSERT INTO order_tombstones (order_uid, version)
+        VALUES ($1, GREATEST($2::BIGINT, COALESCE((SELECT version FROM orders WHERE order_uid = $1), 0)))
+        ON CONFLICT (order_uid) DO UPDATE SET
+            version = GREATEST(order_tombstones.version, EXCLUDED.version),
+            deleted_at = now()
+    `, orderUID, version)
+	if err != nil {
+		return fmt.Errorf("failed to save order tombstone: %w", err)
+	}
+
+	// Заказ
+	if _, err = tx.Exec(ctx, `DELETE FROM orders WHERE order_uid = $1`, orderUID); err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
 	}
 
-	return &ord, nil
+	// Коммит транзакции
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
-// Получение всех заказов (для заполнения кэша при старте)
-func (r *OrderRepository) GetAllOrders(ctx context.Context) (map[string]model.Order, error) {
-	ordersMap := make(map[string]model.Order)
+// Версии, с которыми удалены заказы из uids. Заказов, которые не удалялись, в ответе нет
+func tombstoneVersions(ctx context.Context, tx pgx.Tx, uids []string) (map[string]int64, error) {
+	versions := make(map[string]int64)
+	if len(uids) == 0 {
+		return versions, nil
+	}
 
-	// Получаем все заказы
-	rows, err := r.db.pool.Query(ctx, `
-        SELECT order_uid, track_number, entry, locale, internal_signature, 
-               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        FROM orders
-    `)
+	rows, err := tx.Query(ctx, `SELECT order_uid, version FROM order_tombstones WHERE order_uid = ANY($1)`, uids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all orders: %v", err)
+		return nil, fmt.Errorf("failed to query order tombstones: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var ord model.Order
-		if err := rows.Scan(
-			&ord.OrderUID, &ord.TrackNumber, &ord.Entry, &ord.Locale, &ord.InternalSignature,
-			&ord.CustomerID, &ord.DeliveryService, &ord.Shardkey, &ord.SMID, &ord.DateCreated, &ord.OofShard,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
+		var uid string
+		var version int64
+		if err := rows.Scan(&uid, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan order tombstone: %w", err)
 		}
+		versions[uid] = version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order tombstones: %w", err)
+	}
+	return versions, nil
+}
 
-		// Получаем доставку для каждого заказа
-		err = r.db.pool.QueryRow(ctx, `
-            SELECT name, phone, zip, city, address, region, email
-            FROM delivery
-            WHERE order_uid = $1
-        `, ord.OrderUID).Scan(
-			&ord.Delivery.Name, &ord.Delivery.Phone, &ord.Delivery.Zip,
-			&ord.Delivery.City, &ord.Delivery.Address, &ord.Delivery.Region, &ord.Delivery.Email)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get delivery for order %v: %v", ord.OrderUID, err)
-		}
-
-		// Получаем оплату для каждого заказа
-		err = r.db.pool.QueryRow(ctx, `
-            SELECT transaction, request_id, currency, provider, amount, 
-                   payment_dt, bank, delivery_cost, goods_total, custom_fee
-            FROM payments
-            WHERE order_uid = $1
-        `, ord.OrderUID).Scan(
-			&ord.Payment.Transaction, &ord.Payment.RequestID, &ord.Payment.Currency,
-			&ord.Payment.Provider, &ord.Payment.Amount, &ord.Payment.PaymentDT,
-			&ord.Payment.Bank, &ord.Payment.DeliveryCost, &ord.Payment.GoodsTotal, &ord.Payment.CustomFee)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get payment for order %v: %v", ord.OrderUID, err)
-		}
+// Удалён ли заказ с версией не старше версии ord
+func buried(tombstones map[string]int64, ord model.Order) bool {
+	version, ok := tombstones[ord.OrderUID]
+	return ok && ord.Version <= version
+}
 
-		// Получаем товары для каждого заказа
-		itemRows, err := r.db.pool.Query(ctx, `
-            SELECT i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, 
-                   i.total_price, i.nm_id, i.brand, i.status
-            FROM items i
-            JOIN order_items oi ON i.chrt_id = oi.chrt_id
-            WHERE oi.order_uid = $1
-        `, ord.OrderUID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get items for order %v: %v", ord.OrderUID, err)
+// Если заказ встречается в пачке несколько раз, в БД идёт только самая новая версия
+// (при равных — первая, как при записи по одному). Остальные помечаются устаревшими. Возвращает индексы
+// заказов, которые нужно записать
+func latestOrders(orders []model.Order, statuses []SaveStatus) []int {
+	latest := make(map[string]int, len(orders))
+	keys := make([]string, 0, len(orders))
+	for i, ord := range orders {
+		if statuses[i] != StatusSaved {
+			continue
 		}
+		j, ok := latest[ord.OrderUID]
+		if !ok {
+			latest[ord.OrderUID] = i
+			keys = append(keys, ord.OrderUID)
+			continue
+		}
+		if ord.Version > orders[j].Version {
+			statuses[j] = StatusStale
+			latest[ord.OrderUID] = i
+		} else {
+			statuses[i] = StatusStale
+		}
+	}
 
-		for itemRows.Next() {
-			var item model.Item
-			if err := itemRows.Scan(
-				&item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
-				&item.Sale, &item.Size, &item.TotalPrice, &item.NMID, &item.Brand, &item.Status,
-			); err != nil {
-				itemRows.Close()
-				return nil, fmt.Errorf("failed to scan item for order %v: %v", ord.OrderUID, err)
+	result := make([]int, 0, len(keys))
+	for _, uid := range keys {
+		result = append(result, latest[uid])
+	}
+	return result
+}
+
+// Строки для COPY товаров. Строка заказа определяется rid: строки с одним chrt_id,
+// но разными rid сохраняются по отдельности. Повтор rid в одном заказе схлопывается
+// (побеждает последний), иначе ON CONFLICT упадёт на попытке обновить одну строку дважды
+func itemCopyRows(orders []model.Order) [][]interface{} {
+	type itemKey struct {
+		orderUID string
+		rid      string
+	}
+	itemIndex := make(map[itemKey]int)
+
+	var items [][]interface{}
+	for _, ord := range orders {
+		for _, item := range ord.Items {
+			key := itemKey{ord.OrderUID, item.RID}
+			if i, ok := itemIndex[key]; ok {
+				items[i] = itemArgs(ord.OrderUID, item)
+			} else {
+				itemIndex[key] = len(items)
+				items = append(items, itemArgs(ord.OrderUID, item))
 			}
-			ord.Items = append(ord.Items, item)
 		}
-		itemRows.Close()
+	}
+	return items
+}
 
-		ordersMap[ord.OrderUID] = ord
+func orderArgs(ord model.Order) []interface{} {
+	return []interface{}{
+		ord.OrderUID, ord.TrackNumber, ord.Entry, ord.Locale, ord.InternalSignature,
+		ord.CustomerID, ord.DeliveryService, ord.Shardkey, ord.SMID, ord.DateCreated, ord.OofShard, ord.Version,
 	}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating orders: %v", err)
+func deliveryArgs(ord model.Order) []interface{} {
+	return []interface{}{
+		ord.OrderUID, ord.Delivery.Name, ord.Delivery.Phone, ord.Delivery.Zip,
+		ord.Delivery.City, ord.Delivery.Address, ord.Delivery.Region, ord.Delivery.Email,
+	}
+}
+
+func paymentArgs(ord model.Order) []interface{} {
+	return []interface{}{
+		ord.Payment.Transaction, ord.OrderUID, ord.Payment.RequestID, ord.Payment.Currency,
+		ord.Payment.Provider, ord.Payment.Amount, ord.Payment.PaymentDT,
+		ord.Payment.Bank, ord.Payment.DeliveryCost, ord.Payment.GoodsTotal, ord.Payment.CustomFee,
+	}
+}
+
+func itemArgs(orderUID string, item model.Item) []interface{} {
+	return []interface{}{
+		orderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
+		item.Sale, item.Size, item.TotalPrice, item.NMID, item.Brand, item.Status,
+	}
+}
+
+// Получение заказа по ID. Если заказа нет, возвращается ошибка с ErrNotFound
+func (r *OrderRepository) GetOrderByID(ctx context.Context, orderUID string) (*model.Order, error) {
+	orders, err := r.loadOrders(ctx, `WHERE order_uid = $1`, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("order %v: %w", orderUID, ErrNotFound)
+	}
+	return &orders[0], nil
+}
+
+// Получение всех заказов одной картой. Для больших таблиц — IterateOrders
+func (r *OrderRepository) GetAllOrders(ctx context.Context) (map[string]model.Order, error) {
+	orders, err := r.loadOrders(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return ordersByUID(orders), nil
+}
+
+// Условия выборки для IterateOrders. Нулевые значения полей не ограничивают выборку
+type OrderFilter struct {
+	CreatedFrom time.Time // date_created >= CreatedFrom
+	CreatedTo   time.Time // date_created < CreatedTo
+	CustomerID  string
+	BatchSize   int // заказов в одной порции, по умолчанию DefaultIterateBatchSize
+}
+
+const DefaultIterateBatchSize = 500
+
+// Потоковый обход заказов по возрастанию order_uid. Заказы загружаются полностью
+// собранными порциями по BatchSize с keyset-пагинацией (order_uid > последнего
+// полученного), поэтому в памяти одновременно держится не больше одной порции.
+// Каждая порция читается отдельно: заказ, изменённый во время обхода, придёт
+// в состоянии на момент чтения своей порции. Ошибка из fn прекращает обход
+// и возвращается как есть
+func (r *OrderRepository) IterateOrders(ctx context.Context, filter OrderFilter, fn func(model.Order) error) error {
+	batchSize := filter.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultIterateBatchSize
+	}
+
+	return iterateOrderPages(batchSize, func(afterUID string, limit int) ([]model.Order, error) {
+		where, args := filter.where(afterUID)
+		return r.loadOrders(ctx, fmt.Sprintf("%v ORDER BY order_uid LIMIT %d", where, limit), args...)
+	}, fn)
+}
+
+// Цикл keyset-пагинации IterateOrders. loadPage возвращает до limit заказов
+// с order_uid больше afterUID по возрастанию order_uid; неполная порция — последняя
+func iterateOrderPages(batchSize int, loadPage func(afterUID string, limit int) ([]model.Order, error), fn func(model.Order) error) error {
+	afterUID := ""
+	for {
+		orders, err := loadPage(afterUID, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, ord := range orders {
+			if err := fn(ord); err != nil {
+				return err
+			}
+		}
+		if len(orders) < batchSize {
+			return nil
+		}
+		afterUID = orders[len(orders)-1].OrderUID
 	}
+}
 
-	return ordersMap, nil
+// Условие WHERE для очередной порции и его параметры
+func (f OrderFilter) where(afterUID string) (string, []interface{}) {
+	conds := []string{"order_uid > $1"}
+	args := []interface{}{afterUID}
+	if !f.CreatedFrom.IsZero() {
+		args = append(args, f.CreatedFrom)
+		conds = append(conds, fmt.Sprintf("date_created >= $%d", len(args)))
+	}
+	if !f.CreatedTo.IsZero() {
+		args = append(args, f.CreatedTo)
+		conds = append(conds, fmt.Sprintf("date_created < $%d", len(args)))
+	}
+	if f.CustomerID != "" {
+		args = append(args, f.CustomerID)
+		conds = append(conds, fmt.Sprintf("customer_id = $%d", len(args)))
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
 }
 
-func (r *OrderRepository) GetLastThreeOrders(ctx context.Context) (map[string]model.Order, error) { // Получаем три последних заказа по дате
-	ordersMap := make(map[string]model.Order)
+// Получаем три последних заказа по дате
+func (r *OrderRepository) GetLastThreeOrders(ctx context.Context) (map[string]model.Order, error) {
+	orders, err := r.loadOrders(ctx, `ORDER BY date_created DESC LIMIT 3`)
+	if err != nil {
+		return nil, err
+	}
+	return ordersByUID(orders), nil
+}
 
-	rows, err := r.db.pool.Query(ctx, `
+// Загрузка заказов со всеми частями за четыре запроса независимо от их числа:
+// сначала заказы (filter дописывается после FROM orders), затем доставки, оплаты
+// и товары сразу для всего набора order_uid. Порядок заказов — как в первом запросе.
+// Ошибки драйвера классифицируются для всех методов чтения
+func (r *OrderRepository) loadOrders(ctx context.Context, filter string, args ...interface{}) (_ []model.Order, err error) {
+	defer classifyErr(&err)
+
+	set := newOrderSet()
+
+	rows, err := r.db.conn().Query(ctx, `
         SELECT order_uid, track_number, entry, locale, internal_signature, 
-               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version
         FROM orders
-        ORDER BY date_created DESC
-        LIMIT 3
-    `)
+    `+filter, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last three orders: %v", err)
+		return nil, fmt.Errorf("failed to get orders: %w", err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
+	err = scanEach(rows, "orders", func(row pgx.Rows) error {
 		var ord model.Order
-		if err := rows.Scan(
+		if err := row.Scan(
 			&ord.OrderUID, &ord.TrackNumber, &ord.Entry, &ord.Locale, &ord.InternalSignature,
-			&ord.CustomerID, &ord.DeliveryService, &ord.Shardkey, &ord.SMID, &ord.DateCreated, &ord.OofShard,
+			&ord.CustomerID, &ord.DeliveryService, &ord.Shardkey, &ord.SMID, &ord.DateCreated, &ord.OofShard, &ord.Version,
 		); err != nil {
-			return nil, fmt.Errorf("failed to scan order: %v", err)
+			return err
 		}
+		set.add(ord)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(set.orders) == 0 {
+		return nil, nil
+	}
+	uids := set.uids()
 
-		err = r.db.pool.QueryRow(ctx, `
-            SELECT name, phone, zip, city, address, region, email
-            FROM delivery
-            WHERE order_uid = $1
-        `, ord.OrderUID).Scan(
-			&ord.Delivery.Name, &ord.Delivery.Phone, &ord.Delivery.Zip,
-			&ord.Delivery.City, &ord.Delivery.Address, &ord.Delivery.Region, &ord.Delivery.Email)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get delivery for order %v: %v", ord.OrderUID, err)
-		}
-
-		err = r.db.pool.QueryRow(ctx, `
-            SELECT transaction, request_id, currency, provider, amount, 
-                   payment_dt, bank, delivery_cost, goods_total, custom_fee
-            FROM payments
-            WHERE order_uid = $1
-        `, ord.OrderUID).Scan(
-			&ord.Payment.Transaction, &ord.Payment.RequestID, &ord.Payment.Currency,
-			&ord.Payment.Provider, &ord.Payment.Amount, &ord.Payment.PaymentDT,
-			&ord.Payment.Bank, &ord.Payment.DeliveryCost, &ord.Payment.GoodsTotal, &ord.Payment.CustomFee)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get payment for order %v: %v", ord.OrderUID, err)
+	// Доставки
+	rows, err = r.db.conn().Query(ctx, `
+        SELECT order_uid, name, phone, zip, city, address, region, email
+        FROM delivery
+        WHERE order_uid = ANY($1)
+    `, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	err = scanEach(rows, "deliveries", func(row pgx.Rows) error {
+		var orderUID string
+		var d model.Delivery
+		if err := row.Scan(&orderUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+			return err
+		}
+		if ord := set.get(orderUID); ord != nil {
+			ord.Delivery = d
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		itemRows, err := r.db.pool.Query(ctx, `
-            SELECT i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, 
-                   i.total_price, i.nm_id, i.brand, i.status
-            FROM items i
-            JOIN order_items oi ON i.chrt_id = oi.chrt_id
-            WHERE oi.order_uid = $1
-        `, ord.OrderUID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get items for order %v: %v", ord.OrderUID, err)
+	// Оплаты
+	rows, err = r.db.conn().Query(ctx, `
+        SELECT order_uid, transaction, request_id, currency, provider, amount, 
+               payment_dt, bank, delivery_cost, goods_total, custom_fee
+        FROM payments
+        WHERE order_uid = ANY($1)
+    `, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+	err = scanEach(rows, "payments", func(row pgx.Rows) error {
+		var orderUID string
+		var p model.Payment
+		if err := row.Scan(
+			&orderUID, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
+			&p.PaymentDT, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee,
+		); err != nil {
+			return err
 		}
+		if ord := set.get(orderUID); ord != nil {
+			ord.Payment = p
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		for itemRows.Next() {
-			var item model.Item
-			if err := itemRows.Scan(
-				&item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
-				&item.Sale, &item.Size, &item.TotalPrice, &item.NMID, &item.Brand, &item.Status,
-			); err != nil {
-				itemRows.Close()
-				return nil, fmt.Errorf("failed to scan item for order %v: %v", ord.OrderUID, err)
-			}
+	// Товары
+	rows, err = r.db.conn().Query(ctx, `
+        SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, 
+               total_price, nm_id, brand, status
+        FROM items
+        WHERE order_uid = ANY($1)
+    `, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items: %w", err)
+	}
+	err = scanEach(rows, "items", func(row pgx.Rows) error {
+		var orderUID string
+		var item model.Item
+		if err := row.Scan(
+			&orderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
+			&item.Sale, &item.Size, &item.TotalPrice, &item.NMID, &item.Brand, &item.Status,
+		); err != nil {
+			return err
+		}
+		if ord := set.get(orderUID); ord != nil {
 			ord.Items = append(ord.Items, item)
 		}
-		itemRows.Close()
-
-		ordersMap[ord.OrderUID] = ord
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	return set.orders, nil
+}
+
+// Обход строк результата: scan вызывается для каждой строки, rows закрываются в конце
+func scanEach(rows pgx.Rows, what string, scan func(row pgx.Rows) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to scan %v: %w", what, err)
+		}
+	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating orders: %v", err)
+		return fmt.Errorf("error iterating %v: %w", what, err)
 	}
+	return nil
+}
+
+// Набор заказов в порядке загрузки с поиском по order_uid, куда дописываются
+// доставки, оплаты и товары из следующих запросов
+type orderSet struct {
+	orders []model.Order
+	index  map[string]int
+}
+
+func newOrderSet() *orderSet {
+	return &orderSet{index: make(map[string]int)}
+}
+
+func (s *orderSet) add(ord model.Order) {
+	s.index[ord.OrderUID] = len(s.orders)
+	s.orders = append(s.orders, ord)
+}
 
-	return ordersMap, nil
+// Заказ из набора или nil, если такого order_uid в наборе нет
+func (s *orderSet) get(orderUID string) *model.Order {
+	i, ok := s.index[orderUID]
+	if !ok {
+		return nil
+	}
+	return &s.orders[i]
+}
+
+func (s *orderSet) uids() []string {
+	uids := make([]string, len(s.orders))
+	for i, ord := range s.orders {
+		uids[i] = ord.OrderUID
+	}
+	return uids
+}
+
+func ordersByUID(orders []model.Order) map[string]model.Order {
+	ordersMap := make(map[string]model.Order, len(orders))
+	for _, ord := range orders {
+		ordersMap[ord.OrderUID] = ord
+	}
+	return ordersMap
 }
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"l0/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Тип события о сохранённом заказе
+const EventOrderAccepted = "order.accepted"
+
+// Запись outbox, ожидающая публикации
+type OutboxMessage struct {
+	ID        int64
+	EventType string
+	Key       string // order_uid, он же ключ сообщения Kafka
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// OutboxStore — то, что relay нужно от хранилища outbox
+type OutboxStore interface {
+	// Выбирает до limit неотправленных записей, передаёт их publish и, если тот
+	// отработал без ошибки, помечает отправленными. Возвращает число отправленных
+	ProcessOutbox(ctx context.Context, limit int, publish func([]OutboxMessage) error) (int, error)
+}
+
+const insertOutboxSQL = `
+        INSERT INTO outbox (event_type, message_key, payload)
+        VALUES ($1, $2, $3)
+    `
+
+// Аргументы записи order.accepted для заказа. Пишется в транзакции сохранения заказа
+func orderAcceptedArgs(ord model.Order, acceptedAt time.Time) ([]interface{}, error) {
+	payload, err := json.Marshal(model.OrderAccepted{
+		OrderUID:    ord.OrderUID,
+		TrackNumber: ord.TrackNumber,
+		CustomerID:  ord.CustomerID,
+		Version:     ord.Version,
+		DateCreated: ord.DateCreated,
+		AcceptedAt:  acceptedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %v event: %w", EventOrderAccepted, err)
+	}
+	return []interface{}{EventOrderAccepted, ord.OrderUID, payload}, nil
+}
+
+func enqueueOrderAccepted(ctx context.Context, tx pgx.Tx, ord model.Order) error {
+	args, err := orderAcceptedArgs(ord, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, insertOutboxSQL, args...); err != nil {
+		return fmt.Errorf("failed to save outbox event: %w", err)
+	}
+	return nil
+}
+
+type OutboxRepository struct {
+	db *Postgres
+}
+
+func NewOutboxRepository(db *Postgres) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Записи блокируются FOR UPDATE SKIP LOCKED до конца транзакции, поэтому несколько
+// экземпляров сервиса не публикуют одно и то же параллельно. Если публикация или
+// коммит не удались, записи остаются неотправленными и будут опубликованы повторно
+func (r *OutboxRepository) ProcessOutbox(ctx context.Context, limit int, publish func([]OutboxMessage) error) (_ int, err error) {
+	defer classifyErr(&err)
+
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+        SELECT id, event_type, message_key, payload, created_at
+        FROM outbox
+        WHERE sent_at IS NULL
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    `, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outbox messages: %w", err)
+	}
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		if err := rows.Scan(&msg.ID, &msg.EventType, &msg.Key, &msg.Payload, &msg.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating outbox messages: %w", err)
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(msgs); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	if _, err := tx.Exec(ctx, `UPDATE outbox SET sent_at = now() WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("failed to mark outbox messages sent: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(msgs), nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -30,6 +31,20 @@ func NewPostgres(ctx context.Context, connString string) (*Postgres, error) {
 	return &Postgres{pool: pool}, nil
 }
 
+// Начало транзакции с трассировкой запросов
+func (p *Postgres) begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tracedTx{Tx: tx}, nil
+}
+
+// Запросы вне транзакции с трассировкой
+func (p *Postgres) conn() tracedQuerier {
+	return tracedQuerier{p.pool}
+}
+
 func (p *Postgres) Close() {
 	p.pool.Close()
 }
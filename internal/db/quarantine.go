@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrNotQuarantined — в карантине нет сообщения с таким ID
+var ErrNotQuarantined = fmt.Errorf("quarantined message %w", ErrNotFound)
+
+// Сообщение, которое не удалось обработать, вместе с причиной
+type QuarantinedMessage struct {
+	ID         int64
+	Topic      string
+	Partition  int
+	Offset     int64
+	Key        []byte
+	Value      []byte
+	Headers    []MessageHeader
+	ErrorClass string
+	Error      string
+	Attempts   int
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+// Заголовок сообщения; заголовки хранятся в колонке headers как JSON
+type MessageHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// QuarantineStore — хранилище сообщений в карантине
+type QuarantineStore interface {
+	// Сохраняет сообщение; повторное попадание того же сообщения (topic/partition/offset)
+	// увеличивает число попыток и обновляет ошибку и время последнего появления
+	Quarantine(ctx context.Context, msg QuarantinedMessage) error
+	// До limit сообщений с ID больше afterID, по возрастанию ID
+	ListQuarantined(ctx context.Context, afterID int64, limit int) ([]QuarantinedMessage, error)
+	GetQuarantined(ctx context.Context, id int64) (*QuarantinedMessage, error)
+	DeleteQuarantined(ctx context.Context, id int64) error
+}
+
+type QuarantineRepository struct {
+	db *Postgres
+}
+
+func NewQuarantineRepository(db *Postgres) *QuarantineRepository {
+	return &QuarantineRepository{db: db}
+}
+
+const selectQuarantinedSQL = `
+        SELECT id, topic, kafka_partition, kafka_offset, message_key, payload, headers,
+               error_class, error, attempts, first_seen, last_seen
+        FROM quarantine
+    `
+
+func (r *QuarantineRepository) Quarantine(ctx context.Context, msg QuarantinedMessage) (err error) {
+	defer classifyErr(&err)
+
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message headers: %w", err)
+	}
+
+	_, err = r.db.conn().Exec(ctx, `
+        INSERT INTO quarantine (
+            topic, kafka_partition, kafka_offset, message_key, payload, headers,
+            error_class, error, attempts
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE SET
+            payload = EXCLUDED.payload,
+            headers = EXCLUDED.headers,
+            error_class = EXCLUDED.error_class,
+            error = EXCLUDED.error,
+            attempts = quarantine.attempts + EXCLUDED.attempts,
+            last_seen = now()
+    `, msg.Topic, msg.Partition, msg.Offset, msg.Key, msg.Value, headers,
+		msg.ErrorClass, msg.Error, msg.Attempts)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
+	}
+	return nil
+}
+
+func (r *QuarantineRepository) ListQuarantined(ctx context.Context, afterID int64, limit int) (_ []QuarantinedMessage, err error) {
+	defer classifyErr(&err)
+
+	rows, err := r.db.conn().Query(ctx, selectQuarantinedSQL+`
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2
+    `, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantined messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []QuarantinedMessage{}
+	for rows.Next() {
+		msg, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quarantined messages: %w", err)
+	}
+	return msgs, nil
+}
+
+func (r *QuarantineRepository) GetQuarantined(ctx context.Context, id int64) (_ *QuarantinedMessage, err error) {
+	defer classifyErr(&err)
+
+	msg, err := scanQuarantined(r.db.conn().QueryRow(ctx, selectQuarantinedSQL+`WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotQuarantined
+	}
+	return msg, err
+}
+
+func (r *QuarantineRepository) DeleteQuarantined(ctx context.Context, id int64) (err error) {
+	defer classifyErr(&err)
+
+	tag, err := r.db.conn().Exec(ctx, `DELETE FROM quarantine WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined message: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotQuarantined
+	}
+	return nil
+}
+
+func scanQuarantined(row pgx.Row) (*QuarantinedMessage, error) {
+	var msg QuarantinedMessage
+	var headers []byte
+	err := row.Scan(
+		&msg.ID, &msg.Topic, &msg.Partition, &msg.Offset, &msg.Key, &msg.Value, &headers,
+		&msg.ErrorClass, &msg.Error, &msg.Attempts, &msg.FirstSeen, &msg.LastSeen,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan quarantined message: %w", err)
+	}
+	if err := json.Unmarshal(headers, &msg.Headers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message headers: %w", err)
+	}
+	return &msg, nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"l0/internal/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrItemNotFound — в заказе нет товара с таким chrt_id (и rid) или нет самого заказа
+	ErrItemNotFound = fmt.Errorf("order item %w", ErrNotFound)
+	// ErrAmbiguousItem — в событии нет rid, а товар встречается в заказе несколькими строками
+	ErrAmbiguousItem = fmt.Errorf("order item without rid is ambiguous: %w", ErrConflict)
+)
+
+// ItemStatusStore — обновление статусов товаров по событиям жизненного цикла заказа
+type ItemStatusStore interface {
+	UpdateItemStatus(ctx context.Context, event model.ItemStatusEvent, refs ...MessageRef) error
+}
+
+// Обновление статуса одной строки заказа. Статус меняется, только если событие не старше
+// последнего применённого, иначе возвращается ErrStale. Для уже обработанного
+// сообщения возвращается ErrDuplicate, для события без rid по товару, который
+// встречается в заказе несколько раз, — ErrAmbiguousItem
+func (r *OrderRepository) UpdateItemStatus(ctx context.Context, event model.ItemStatusEvent, refs ...MessageRef) (err error) {
+	defer classifyErr(&err)
+
+	tx, err := r.db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Журнал обработанных сообщений
+	for _, ref := range refs {
+		fresh, err := recordMessage(ctx, tx, ref, event.OrderUID)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrDuplicate
+		}
+	}
+
+	// Строка заказа: по rid, а без него — по chrt_id, если такая строка в заказе одна
+	rid, err := lockItemLine(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE items
+        SET status = $3, status_changed_at = $4
+        WHERE order_uid = $1 AND rid = $2
+          AND (status_changed_at IS NULL OR status_changed_at <= $4)
+    `, event.OrderUID, rid, event.Status, event.ChangedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update item status: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		// Статус уже изменён более новым событием: фиксируем только запись в журнале
+		if err = tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return ErrStale
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// rid строки заказа, к которой относится событие. Строка блокируется до конца транзакции
+func lockItemLine(ctx context.Context, tx pgx.Tx, event model.ItemStatusEvent) (string, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT rid FROM items
+        WHERE order_uid = $1 AND chrt_id = $2 AND ($3::text = '' OR rid = $3)
+        FOR UPDATE
+    `, event.OrderUID, event.ChrtID, event.RID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find order item: %w", err)
+	}
+	var rids []string
+	err = scanEach(rows, "order items", func(row pgx.Rows) error {
+		var rid string
+		if err := row.Scan(&rid); err != nil {
+			return err
+		}
+		rids = append(rids, rid)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch len(rids) {
+	case 0:
+		return "", ErrItemNotFound
+	case 1:
+		return rids[0], nil
+	default:
+		return "", ErrAmbiguousItem
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"l0/internal/tracing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "l0/internal/db"
+
+// Транзакция, в которой на каждый запрос создаётся дочерний спан. В pgx v4 нет
+// хуков трассировки, поэтому оборачиваются методы, которыми пользуются репозитории
+type tracedTx struct {
+	pgx.Tx
+}
+
+// То, через что выполняются запросы: транзакция или пул соединений
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Запросы со спанами поверх транзакции или пула: чтения вне транзакции
+// трассируются так же, как запросы в tracedTx
+type tracedQuerier struct {
+	q querier
+}
+
+// Спан запроса: имя — операция (INSERT, UPDATE, ...), текст запроса в атрибуте
+func startStatementSpan(ctx context.Context, sql string) (context.Context, trace.Span) {
+	query := strings.Join(strings.Fields(sql), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	return otel.Tracer(tracerName).Start(ctx, strings.ToUpper(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", strings.ToUpper(operation)),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		tracing.RecordError(span, err)
+	}
+	span.End()
+}
+
+func (t tracedQuerier) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startStatementSpan(ctx, sql)
+	tag, err := t.q.Exec(ctx, sql, args...)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("db.rows_affected", tag.RowsAffected()))
+	}
+	endSpan(span, err)
+	return tag, err
+}
+
+func (t tracedQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startStatementSpan(ctx, sql)
+	rows, err := t.q.Query(ctx, sql, args...)
+	if err != nil {
+		endSpan(span, err)
+		return rows, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (t tracedQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := startStatementSpan(ctx, sql)
+	return tracedRow{row: t.q.QueryRow(ctx, sql, args...), span: span}
+}
+
+func (tx tracedTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tracedQuerier{tx.Tx}.Exec(ctx, sql, args...)
+}
+
+func (tx tracedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return tracedQuerier{tx.Tx}.Query(ctx, sql, args...)
+}
+
+func (tx tracedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tracedQuerier{tx.Tx}.QueryRow(ctx, sql, args...)
+}
+
+func (tx tracedTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "BATCH",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.Int("db.operation.batch.size", b.Len()),
+		),
+	)
+	return &tracedBatchResults{BatchResults: tx.Tx.SendBatch(ctx, b), span: span}
+}
+
+func (tx tracedTx) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "COPY "+table.Sanitize(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", "COPY"),
+			attribute.String("db.collection.name", table.Sanitize()),
+		),
+	)
+	n, err := tx.Tx.CopyFrom(ctx, table, columns, src)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("db.rows_affected", n))
+	}
+	endSpan(span, err)
+	return n, err
+}
+
+func (tx tracedTx) Commit(ctx context.Context) error {
+	ctx, span := startStatementSpan(ctx, "COMMIT")
+	err := tx.Tx.Commit(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// Спан запроса заканчивается, когда строки прочитаны или закрыты, смотря что
+// случится раньше. Обычно бывает и то и другое, а спан завершается один раз
+type tracedRows struct {
+	pgx.Rows
+	span  trace.Span
+	ended bool
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.end()
+	return false
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.end()
+}
+
+func (r *tracedRows) end() {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	endSpan(r.span, r.Rows.Err())
+}
+
+type tracedRow struct {
+	row  pgx.Row
+	span trace.Span
+}
+
+func (r tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	endSpan(r.span, err)
+	return err
+}
+
+// Спан пачки заканчивается при закрытии результатов
+type tracedBatchResults struct {
+	pgx.BatchResults
+	span trace.Span
+}
+
+func (r *tracedBatchResults) Close() error {
+	err := r.BatchResults.Close()
+	endSpan(r.span, err)
+	return err
+}
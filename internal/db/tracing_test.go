@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"l0/internal/tracing"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Транзакция, в которой определён только Exec
+type fakeTx struct {
+	pgx.Tx
+	execErr error
+}
+
+func (tx fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if tx.execErr != nil {
+		return nil, tx.execErr
+	}
+	return pgconn.CommandTag("INSERT 0 1"), nil
+}
+
+func TestTracedTx_ExecCreatesStatementSpans(t *testing.T) {
+	exporter, restore := tracing.InstallInMemory()
+	defer restore()
+
+	tx := tracedTx{Tx: fakeTx{}}
+	if _, err := tx.Exec(context.Background(), "INSERT INTO orders\n\t(order_uid) VALUES ($1)", "x"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	failing := tracedTx{Tx: fakeTx{execErr: errors.New("connection reset")}}
+	if _, err := failing.Exec(context.Background(), "UPDATE items SET status = $1", 1); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "INSERT" || spans[0].Status.Code == codes.Error {
+		t.Errorf("Unexpected insert span: %v %v", spans[0].Name, spans[0].Status)
+	}
+	for _, attr := range spans[0].Attributes {
+		if attr.Key == "db.query.text" && attr.Value.AsString() != "INSERT INTO orders (order_uid) VALUES ($1)" {
+			t.Errorf("Query text should be normalized, got %q", attr.Value.AsString())
+		}
+	}
+	if spans[1].Name != "UPDATE" || spans[1].Status.Code != codes.Error {
+		t.Errorf("Failed statement span should have error status: %v %v", spans[1].Name, spans[1].Status)
+	}
+}
+
+// Пул соединений, в котором определён только Query; строк нет
+type fakeQuerier struct {
+	querier
+}
+
+func (q fakeQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return fakeRows{}, nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+}
+
+func (fakeRows) Next() bool { return false }
+func (fakeRows) Close()     {}
+func (fakeRows) Err() error { return nil }
+
+func TestTracedQuerier_QuerySpanEndsOnce(t *testing.T) {
+	exporter, restore := tracing.InstallInMemory()
+	defer restore()
+
+	rows, err := tracedQuerier{fakeQuerier{}}.Query(context.Background(), "SELECT order_uid FROM orders")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "SELECT" {
+		t.Fatalf("Expected one SELECT span, got %v", spans)
+	}
+	if !rows.(*tracedRows).ended {
+		t.Error("Span should be marked as ended")
+	}
+}
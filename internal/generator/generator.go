@@ -0,0 +1,300 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"l0/internal/model"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Вид сгенерированного сообщения
+type Kind string
+
+const (
+	KindValid     Kind = "valid"
+	KindInvalid   Kind = "invalid"   // не проходит декодирование или валидацию
+	KindDuplicate Kind = "duplicate" // повтор уже отправленного сообщения с тем же event-id
+	KindStale     Kind = "stale"     // более старая версия уже отправленного заказа
+)
+
+// Доли особых сообщений, от 0 до 1; остальные — новые корректные заказы
+type Options struct {
+	InvalidRatio   float64
+	DuplicateRatio float64
+	StaleRatio     float64
+}
+
+func (o Options) Validate() error {
+	for name, ratio := range map[string]float64{
+		"invalid":   o.InvalidRatio,
+		"duplicate": o.DuplicateRatio,
+		"stale":     o.StaleRatio,
+	} {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("%v ratio must be between 0 and 1, got %v", name, ratio)
+		}
+	}
+	if sum := o.InvalidRatio + o.DuplicateRatio + o.StaleRatio; sum > 1 {
+		return fmt.Errorf("sum of ratios must not exceed 1, got %v", sum)
+	}
+	return nil
+}
+
+// Сообщение с заказом: тело и то, что продюсер кладёт в ключ и заголовки
+type Message struct {
+	Kind     Kind
+	OrderUID string
+	EventID  string
+	Version  int64
+	Payload  []byte
+}
+
+// Сколько последних корректных сообщений хранится для повторов и устаревших версий
+const historySize = 100
+
+// Generator создаёт случайные заказы, которые проходят теги валидации model.Order.
+// Не потокобезопасен
+type Generator struct {
+	rnd     *rand.Rand
+	opts    Options
+	seq     int64
+	history []Message
+}
+
+func New(seed int64, opts Options) *Generator {
+	return &Generator{
+		rnd:  rand.New(rand.NewSource(seed)),
+		opts: opts,
+	}
+}
+
+// Следующее сообщение. Повторы и устаревшие версии возможны только после
+// хотя бы одного корректного заказа, до этого вместо них идут новые заказы
+func (g *Generator) Next() (Message, error) {
+	g.seq++
+	p := g.rnd.Float64()
+
+	switch {
+	case p < g.opts.InvalidRatio:
+		return g.invalid()
+	case p < g.opts.InvalidRatio+g.opts.DuplicateRatio && len(g.history) > 0:
+		msg := g.history[g.rnd.Intn(len(g.history))]
+		msg.Kind = KindDuplicate
+		return msg, nil
+	case p < g.opts.InvalidRatio+g.opts.DuplicateRatio+g.opts.StaleRatio && len(g.history) > 0:
+		return g.stale()
+	}
+
+	order := g.Order()
+	msg, err := g.message(KindValid, order)
+	if err != nil {
+		return msg, err
+	}
+	g.remember(msg)
+	return msg, nil
+}
+
+// Случайный корректный заказ
+func (g *Generator) Order() model.Order {
+	uid := g.uuid()
+	track := "WB" + g.upper(10)
+	created := time.Now().UTC().Add(-time.Duration(g.rnd.Intn(3600)) * time.Second).Truncate(time.Second)
+
+	items := make([]model.Item, 1+g.rnd.Intn(4))
+	var goodsTotal int
+	for i := range items {
+		price := float64(100 + g.rnd.Intn(9900))
+		sale := float64(g.rnd.Intn(10) * 10)
+		total := price * (100 - sale) / 100
+		goodsTotal += int(total)
+		items[i] = model.Item{
+			ChrtID:      1000000 + g.rnd.Intn(9000000),
+			TrackNumber: track,
+			Price:       price,
+			RID:         g.hex(20),
+			Name:        pick(g.rnd, productNames),
+			Sale:        sale,
+			Size:        pick(g.rnd, sizes),
+			TotalPrice:  total,
+			NMID:        1000000 + g.rnd.Intn(9000000),
+			Brand:       pick(g.rnd, brands),
+			Status:      pick(g.rnd, itemStatuses),
+		}
+	}
+
+	deliveryCost := float64(100 + g.rnd.Intn(1900))
+	customFee := float64(1 + g.rnd.Intn(100))
+	name := pick(g.rnd, firstNames) + " " + pick(g.rnd, lastNames)
+
+	return model.Order{
+		OrderUID:          uid,
+		TrackNumber:       track,
+		Entry:             "WBIL",
+		Locale:            pick(g.rnd, locales),
+		InternalSignature: g.hex(8),
+		CustomerID:        "customer-" + g.digits(6),
+		DeliveryService:   pick(g.rnd, deliveryServices),
+		Shardkey:          g.digits(1),
+		SMID:              1 + g.rnd.Intn(999),
+		DateCreated:       created,
+		OofShard:          g.digits(1),
+		Delivery: model.Delivery{
+			Name:    name,
+			Phone:   "8" + g.digits(10),
+			Zip:     g.digits(6),
+			City:    pick(g.rnd, cities),
+			Address: pick(g.rnd, streets) + " " + g.digits(2),
+			Region:  pick(g.rnd, regions),
+			Email:   strings.ToLower(strings.ReplaceAll(name, " ", ".")) + "@example.com",
+		},
+		Payment: model.Payment{
+			Transaction:  uid,
+			RequestID:    g.hex(8),
+			Currency:     pick(g.rnd, currencies),
+			Provider:     pick(g.rnd, providers),
+			Amount:       float64(goodsTotal) + deliveryCost + customFee,
+			PaymentDT:    created.Unix(),
+			Bank:         pick(g.rnd, banks),
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goodsTotal,
+			CustomFee:    customFee,
+		},
+		Items: items,
+	}
+}
+
+// Сообщение, которое не пройдёт декодирование или одну из проверок
+func (g *Generator) invalid() (Message, error) {
+	order := g.Order()
+	switch g.rnd.Intn(6) {
+	case 0:
+		return Message{
+			Kind:     KindInvalid,
+			OrderUID: order.OrderUID,
+			EventID:  g.eventID(),
+			Version:  g.version(),
+			Payload:  []byte(`{"order_uid": "` + order.OrderUID + `", "items": [`),
+		}, nil
+	case 1:
+		order.OrderUID = "not-a-uuid"
+	case 2:
+		order.Delivery.Phone = g.digits(7)
+	case 3:
+		order.Payment.Currency = "GBP"
+	case 4:
+		order.Items = nil
+	case 5:
+		order.Items[0].Status = 0
+	}
+	return g.message(KindInvalid, order)
+}
+
+// Заказ из истории с изменённым статусом товаров и версией меньше отправленной
+func (g *Generator) stale() (Message, error) {
+	prev := g.history[g.rnd.Intn(len(g.history))]
+
+	var order model.Order
+	if err := json.Unmarshal(prev.Payload, &order); err != nil {
+		return Message{}, fmt.Errorf("failed to decode order from history: %w", err)
+	}
+	for i := range order.Items {
+		order.Items[i].Status = pick(g.rnd, itemStatuses)
+	}
+	order.Version = prev.Version - 1
+
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode order: %w", err)
+	}
+	return Message{
+		Kind:     KindStale,
+		OrderUID: order.OrderUID,
+		EventID:  g.eventID(),
+		Version:  order.Version,
+		Payload:  payload,
+	}, nil
+}
+
+func (g *Generator) message(kind Kind, order model.Order) (Message, error) {
+	order.Version = g.version()
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode order: %w", err)
+	}
+	return Message{
+		Kind:     kind,
+		OrderUID: order.OrderUID,
+		EventID:  g.eventID(),
+		Version:  order.Version,
+		Payload:  payload,
+	}, nil
+}
+
+func (g *Generator) remember(msg Message) {
+	if len(g.history) < historySize {
+		g.history = append(g.history, msg)
+		return
+	}
+	g.history[g.rnd.Intn(historySize)] = msg
+}
+
+// Версия растёт вместе с временем и номером сообщения, чтобы не повторяться
+func (g *Generator) version() int64 {
+	return time.Now().UnixMicro()*10 + g.seq%10
+}
+
+func (g *Generator) eventID() string {
+	return "gen-" + g.uuid()
+}
+
+// UUID версии 4 из того же источника случайных чисел, что и остальные поля
+func (g *Generator) uuid() string {
+	var b [16]byte
+	g.rnd.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (g *Generator) digits(n int) string {
+	return g.fromAlphabet("0123456789", n)
+}
+
+func (g *Generator) hex(n int) string {
+	return g.fromAlphabet("0123456789abcdef", n)
+}
+
+func (g *Generator) upper(n int) string {
+	return g.fromAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZ", n)
+}
+
+func (g *Generator) fromAlphabet(alphabet string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[g.rnd.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func pick[T any](rnd *rand.Rand, values []T) T {
+	return values[rnd.Intn(len(values))]
+}
+
+var (
+	locales          = []string{"ru", "en", "kz", "by"}
+	currencies       = []string{"USD", "RUB", "EUR"}
+	providers        = []string{"wbpay", "sbp", "card"}
+	banks            = []string{"alpha", "sber", "tinkoff", "vtb"}
+	deliveryServices = []string{"meest", "cdek", "boxberry", "wb"}
+	itemStatuses     = []int{1, 2, 50, 100}
+	sizes            = []string{"0", "XS", "S", "M", "L", "XL", "42", "44"}
+	brands           = []string{"Vivienne Sabo", "Nike", "Adidas", "Samsung", "Xiaomi", "IKEA"}
+	productNames     = []string{"Mascaras", "Кроссовки", "Футболка", "Наушники", "Чехол для телефона", "Лампа настольная"}
+	firstNames       = []string{"Ivan", "Petr", "Anna", "Maria", "Test", "Olga"}
+	lastNames        = []string{"Ivanov", "Petrov", "Smirnova", "Testov", "Kuznetsova"}
+	cities           = []string{"Moscow", "Kazan", "Novosibirsk", "Kiryat Mozkin", "Saint Petersburg"}
+	regions          = []string{"Moscow Region", "Tatarstan", "Kraiot", "Leningrad Region"}
+	streets          = []string{"Ploshad Mira", "Lenina street", "Tverskaya street", "Nevsky prospect"}
+)
@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"encoding/json"
+	"l0/internal/model"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestGenerator_OrdersPassValidation(t *testing.T) {
+	val := validator.New()
+	gen := New(1, Options{})
+
+	for i := 0; i < 500; i++ {
+		if err := val.Struct(gen.Order()); err != nil {
+			t.Fatalf("Generated order must be valid: %v", err)
+		}
+	}
+}
+
+func TestGenerator_Next(t *testing.T) {
+	val := validator.New()
+	gen := New(2, Options{InvalidRatio: 0.2, DuplicateRatio: 0.2, StaleRatio: 0.2})
+
+	versions := make(map[string]int64) // последняя корректная версия по event-id
+	seen := make(map[Kind]int)
+	for i := 0; i < 1000; i++ {
+		msg, err := gen.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		seen[msg.Kind]++
+
+		var order model.Order
+		decodeErr := json.Unmarshal(msg.Payload, &order)
+
+		switch msg.Kind {
+		case KindInvalid:
+			if decodeErr == nil && val.Struct(order) == nil {
+				t.Errorf("Invalid message passed validation: %s", msg.Payload)
+			}
+		case KindValid:
+			if decodeErr != nil || val.Struct(order) != nil {
+				t.Errorf("Valid message failed validation: %s", msg.Payload)
+			}
+			versions[msg.EventID] = msg.Version
+		case KindDuplicate:
+			if _, ok := versions[msg.EventID]; !ok {
+				t.Errorf("Duplicate must repeat a sent event-id, got %v", msg.EventID)
+			}
+		case KindStale:
+			if decodeErr != nil || val.Struct(order) != nil {
+				t.Errorf("Stale message failed validation: %s", msg.Payload)
+			}
+			if order.Version != msg.Version {
+				t.Errorf("Version in body %v differs from message version %v", order.Version, msg.Version)
+			}
+		}
+	}
+
+	for _, kind := range []Kind{KindValid, KindInvalid, KindDuplicate, KindStale} {
+		if seen[kind] == 0 {
+			t.Errorf("Expected some %v messages", kind)
+		}
+	}
+}
+
+func TestGenerator_StaleVersionIsOlder(t *testing.T) {
+	gen := New(3, Options{StaleRatio: 1})
+
+	first, err := gen.Next()
+	if err != nil || first.Kind != KindValid {
+		t.Fatalf("First message must be a valid order, got %v, %v", first.Kind, err)
+	}
+	stale, err := gen.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+
+	if stale.Kind != KindStale || stale.OrderUID != first.OrderUID {
+		t.Fatalf("Expected stale version of %v, got %+v", first.OrderUID, stale)
+	}
+	if stale.Version >= first.Version || stale.EventID == first.EventID {
+		t.Errorf("Stale event must be older and have its own event-id: %+v vs %+v", stale, first)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := (Options{InvalidRatio: 0.5, DuplicateRatio: 0.5}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := (Options{InvalidRatio: -0.1}).Validate(); err == nil {
+		t.Error("Expected error for negative ratio")
+	}
+	if err := (Options{InvalidRatio: 0.6, StaleRatio: 0.6}).Validate(); err == nil {
+		t.Error("Expected error when ratios exceed 1")
+	}
+}
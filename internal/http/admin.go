@@ -0,0 +1,150 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"l0/internal/db"
+	"l0/internal/kafka"
+)
+
+// ConsumerAdmin — административные операции консьюмера заказов
+type ConsumerAdmin interface {
+	Pause()
+	Resume()
+	Paused() bool
+	ResetOffsets(ctx context.Context, reset kafka.OffsetReset) error
+	Reprocess(ctx context.Context, entry db.QuarantinedMessage) (string, error)
+}
+
+// Тело запроса на сброс смещений
+type ResetOffsetsRequest struct {
+	To        string    `json:"to"` // earliest, latest, timestamp или offset
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Offset    int64     `json:"offset,omitempty"`
+	Partition *int      `json:"partition,omitempty"`
+}
+
+type ConsumerStatus struct {
+	Paused bool `json:"paused"`
+}
+
+// Служебные эндпоинты /admin/consumer/* и /admin/quarantine/*. Доступ только
+// с заголовком Authorization: Bearer <token>
+type AdminHandler struct {
+	consumer   ConsumerAdmin
+	quarantine db.QuarantineStore
+	token      string
+	mux        *http.ServeMux
+	logger     *log.Logger
+}
+
+// quarantine может быть nil — тогда эндпоинты карантина не регистрируются
+func NewAdminHandler(consumer ConsumerAdmin, quarantine db.QuarantineStore, token string, logger *log.Logger) *AdminHandler {
+	h := &AdminHandler{
+		consumer:   consumer,
+		quarantine: quarantine,
+		token:      token,
+		mux:        http.NewServeMux(),
+		logger:     logger,
+	}
+
+	h.mux.HandleFunc("GET /admin/consumer", h.handleStatus)
+	h.mux.HandleFunc("POST /admin/consumer/pause", h.handlePause)
+	h.mux.HandleFunc("POST /admin/consumer/resume", h.handleResume)
+	h.mux.HandleFunc("POST /admin/consumer/reset-offsets", h.handleResetOffsets)
+
+	if quarantine != nil {
+		h.mux.HandleFunc("GET /admin/quarantine", h.handleListQuarantine)
+		h.mux.HandleFunc("GET /admin/quarantine/{id}", h.handleGetQuarantined)
+		h.mux.HandleFunc("POST /admin/quarantine/{id}/reprocess", h.handleReprocessQuarantined)
+		h.mux.HandleFunc("DELETE /admin/quarantine/{id}", h.handleDiscardQuarantined)
+	}
+
+	return h
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *AdminHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeStatus(w)
+}
+
+func (h *AdminHandler) handlePause(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("Запрос на приостановку консьюмера от %v", r.RemoteAddr)
+	h.consumer.Pause()
+	h.writeStatus(w)
+}
+
+func (h *AdminHandler) handleResume(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("Запрос на возобновление консьюмера от %v", r.RemoteAddr)
+	h.consumer.Resume()
+	h.writeStatus(w)
+}
+
+// Сброс смещений должен уложиться в WriteTimeout сервера, иначе клиент не узнает результат
+const resetOffsetsTimeout = 8 * time.Second
+
+func (h *AdminHandler) handleResetOffsets(w http.ResponseWriter, r *http.Request) {
+	var req ResetOffsetsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reset := kafka.OffsetReset{
+		Mode:      kafka.OffsetResetMode(req.To),
+		Timestamp: req.Timestamp,
+		Offset:    req.Offset,
+		Partition: req.Partition,
+	}
+	if err := reset.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Printf("Запрос на сброс смещений (%v) от %v", reset.Mode, r.RemoteAddr)
+
+	ctx, cancel := context.WithTimeout(r.Context(), resetOffsetsTimeout)
+	defer cancel()
+	err := h.consumer.ResetOffsets(ctx, reset)
+	if errors.Is(err, kafka.ErrNotPaused) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Ошибка сброса смещений: %v", err)
+		http.Error(w, "Failed to reset offsets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeStatus(w)
+}
+
+func (h *AdminHandler) writeStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ConsumerStatus{Paused: h.consumer.Paused()}); err != nil {
+		h.logger.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"io"
+	"l0/internal/db"
+	"l0/internal/kafka"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockConsumerAdmin struct {
+	paused      bool
+	resetFn     func(ctx context.Context, reset kafka.OffsetReset) error
+	reprocessFn func(ctx context.Context, entry db.QuarantinedMessage) (string, error)
+}
+
+func (m *MockConsumerAdmin) Pause()       { m.paused = true }
+func (m *MockConsumerAdmin) Resume()      { m.paused = false }
+func (m *MockConsumerAdmin) Paused() bool { return m.paused }
+
+func (m *MockConsumerAdmin) ResetOffsets(ctx context.Context, reset kafka.OffsetReset) error {
+	if m.resetFn != nil {
+		return m.resetFn(ctx, reset)
+	}
+	return nil
+}
+
+func (m *MockConsumerAdmin) Reprocess(ctx context.Context, entry db.QuarantinedMessage) (string, error) {
+	if m.reprocessFn != nil {
+		return m.reprocessFn(ctx, entry)
+	}
+	return "saved", nil
+}
+
+func adminRequest(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandler_RequiresToken(t *testing.T) {
+	consumer := &MockConsumerAdmin{}
+	h := NewAdminHandler(consumer, nil, "secret", log.New(io.Discard, "", 0))
+
+	for _, token := range []string{"", "wrong"} {
+		rec := adminRequest(h, http.MethodPost, "/admin/consumer/pause", token, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %v", token, rec.Code)
+		}
+	}
+	if consumer.paused {
+		t.Error("Consumer must not be paused without a valid token")
+	}
+}
+
+func TestAdminHandler_PauseAndResume(t *testing.T) {
+	consumer := &MockConsumerAdmin{}
+	h := NewAdminHandler(consumer, nil, "secret", log.New(io.Discard, "", 0))
+
+	rec := adminRequest(h, http.MethodPost, "/admin/consumer/pause", "secret", "")
+	if rec.Code != http.StatusOK || !consumer.paused {
+		t.Fatalf("Expected consumer to be paused, got %v: %v", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"paused":true`) {
+		t.Errorf("Unexpected status body: %v", rec.Body.String())
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/admin/consumer/resume", "secret", "")
+	if rec.Code != http.StatusOK || consumer.paused {
+		t.Errorf("Expected consumer to be resumed, got %v", rec.Code)
+	}
+}
+
+func TestAdminHandler_ResetOffsets(t *testing.T) {
+	var got kafka.OffsetReset
+	consumer := &MockConsumerAdmin{
+		resetFn: func(ctx context.Context, reset kafka.OffsetReset) error {
+			got = reset
+			return nil
+		},
+	}
+	h := NewAdminHandler(consumer, nil, "secret", log.New(io.Discard, "", 0))
+
+	rec := adminRequest(h, http.MethodPost, "/admin/consumer/reset-offsets", "secret",
+		`{"to":"offset","offset":42,"partition":1}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v: %v", rec.Code, rec.Body.String())
+	}
+	if got.Mode != kafka.ResetToOffset || got.Offset != 42 || got.Partition == nil || *got.Partition != 1 {
+		t.Errorf("Unexpected reset passed to consumer: %+v", got)
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/admin/consumer/reset-offsets", "secret", `{"to":"middle"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown mode, got %v", rec.Code)
+	}
+
+	consumer.resetFn = func(ctx context.Context, reset kafka.OffsetReset) error {
+		return kafka.ErrNotPaused
+	}
+	rec = adminRequest(h, http.MethodPost, "/admin/consumer/reset-offsets", "secret", `{"to":"earliest"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when consumer is running, got %v", rec.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"l0/internal/db"
+	"l0/internal/kafka"
+	"l0/internal/validation"
+)
+
+const (
+	defaultQuarantineLimit = 50
+	maxQuarantineLimit     = 500
+)
+
+// Краткие сведения о сообщении в карантине, без тела
+type QuarantineSummary struct {
+	ID         int64     `json:"id"`
+	Topic      string    `json:"topic"`
+	Partition  int       `json:"partition"`
+	Offset     int64     `json:"offset"`
+	Key        string    `json:"key"`
+	ErrorClass string    `json:"error_class"`
+	Error      string    `json:"error"`
+	Attempts   int       `json:"attempts"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type QuarantineList struct {
+	Messages []QuarantineSummary `json:"messages"`
+	// ID последнего сообщения страницы для следующего запроса (after_id); 0 — страниц больше нет
+	NextAfterID int64 `json:"next_after_id"`
+}
+
+// Сообщение в карантине целиком. Тело отдаётся строкой, если это корректный UTF-8,
+// иначе в base64 (payload_encoding: base64)
+type QuarantineEntry struct {
+	QuarantineSummary
+	Payload         string             `json:"payload"`
+	PayloadEncoding string             `json:"payload_encoding"`
+	Headers         []QuarantineHeader `json:"headers"`
+}
+
+type QuarantineHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Тело запроса на повторную обработку. Если payload задан, он заменяет тело
+// сообщения, а content-type сообщения становится application/json
+type ReprocessRequest struct {
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type ReprocessResult struct {
+	ID     int64  `json:"id"`
+	Result string `json:"result"` // saved, deleted, duplicate или stale
+}
+
+// Ошибка повторной обработки: сообщение по-прежнему не проходит десериализацию или валидацию.
+// Для ошибок валидации fields перечисляет нарушения по полям
+type ReprocessFailure struct {
+	ErrorClass string            `json:"error_class"`
+	Error      string            `json:"error"`
+	Fields     validation.Errors `json:"fields,omitempty"`
+}
+
+func (h *AdminHandler) handleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	limit := defaultQuarantineLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxQuarantineLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxQuarantineLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	var afterID int64
+	if value := r.URL.Query().Get("after_id"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "after_id must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		afterID = parsed
+	}
+
+	msgs, err := h.quarantine.ListQuarantined(r.Context(), afterID, limit)
+	if err != nil {
+		h.logger.Printf("Ошибка получения сообщений из карантина: %v", err)
+		writeStoreError(w, err, "Failed to list quarantined messages")
+		return
+	}
+
+	list := QuarantineList{Messages: make([]QuarantineSummary, len(msgs))}
+	for i, msg := range msgs {
+		list.Messages[i] = quarantineSummary(msg)
+	}
+	if len(msgs) == limit {
+		list.NextAfterID = msgs[len(msgs)-1].ID
+	}
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+func (h *AdminHandler) handleGetQuarantined(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.loadQuarantined(w, r)
+	if !ok {
+		return
+	}
+	h.writeJSON(w, http.StatusOK, quarantineEntry(*msg))
+}
+
+func (h *AdminHandler) handleReprocessQuarantined(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.loadQuarantined(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Payload) > 0 {
+		msg.Value = req.Payload
+		setContentType(msg, kafka.ContentTypeJSON)
+	}
+
+	h.logger.Printf("Запрос на повторную обработку сообщения %v из карантина от %v", msg.ID, r.RemoteAddr)
+
+	result, err := h.consumer.Reprocess(r.Context(), *msg)
+	var procErr *kafka.ProcessingError
+	if errors.As(err, &procErr) {
+		failure := ReprocessFailure{
+			ErrorClass: string(procErr.Class),
+			Error:      procErr.Err.Error(),
+		}
+		errors.As(procErr.Err, &failure.Fields)
+		h.writeJSON(w, http.StatusUnprocessableEntity, failure)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Ошибка повторной обработки сообщения %v из карантина: %v", msg.ID, err)
+		writeStoreError(w, err, "Failed to reprocess message: "+err.Error())
+		return
+	}
+
+	// Заказ уже сохранён, поэтому ошибка удаления из карантина только логируется:
+	// повторная обработка того же сообщения даст duplicate
+	if err := h.quarantine.DeleteQuarantined(r.Context(), msg.ID); err != nil && !errors.Is(err, db.ErrNotQuarantined) {
+		h.logger.Printf("Ошибка удаления сообщения %v из карантина: %v", msg.ID, err)
+	}
+
+	h.writeJSON(w, http.StatusOK, ReprocessResult{ID: msg.ID, Result: result})
+}
+
+func (h *AdminHandler) handleDiscardQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, ok := quarantineID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.quarantine.DeleteQuarantined(r.Context(), id)
+	if errors.Is(err, db.ErrNotQuarantined) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Ошибка удаления сообщения %v из карантина: %v", id, err)
+		writeStoreError(w, err, "Failed to discard message")
+		return
+	}
+
+	h.logger.Printf("Сообщение %v удалено из карантина по запросу от %v", id, r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Сообщение из карантина по {id} из пути. При ошибке ответ уже отправлен
+func (h *AdminHandler) loadQuarantined(w http.ResponseWriter, r *http.Request) (*db.QuarantinedMessage, bool) {
+	id, ok := quarantineID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	msg, err := h.quarantine.GetQuarantined(r.Context(), id)
+	if errors.Is(err, db.ErrNotQuarantined) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Printf("Ошибка получения сообщения %v из карантина: %v", id, err)
+		writeStoreError(w, err, "Failed to get quarantined message")
+		return nil, false
+	}
+	return msg, true
+}
+
+func quarantineID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid quarantine message id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Printf("Error encoding response: %v", err)
+	}
+}
+
+func setContentType(msg *db.QuarantinedMessage, contentType string) {
+	for i, header := range msg.Headers {
+		if strings.EqualFold(header.Key, kafka.HeaderContentType) {
+			msg.Headers[i].Value = []byte(contentType)
+			return
+		}
+	}
+	msg.Headers = append(msg.Headers, db.MessageHeader{Key: kafka.HeaderContentType, Value: []byte(contentType)})
+}
+
+func quarantineSummary(msg db.QuarantinedMessage) QuarantineSummary {
+	return QuarantineSummary{
+		ID:         msg.ID,
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Key:        string(msg.Key),
+		ErrorClass: msg.ErrorClass,
+		Error:      msg.Error,
+		Attempts:   msg.Attempts,
+		FirstSeen:  msg.FirstSeen,
+		LastSeen:   msg.LastSeen,
+	}
+}
+
+func quarantineEntry(msg db.QuarantinedMessage) QuarantineEntry {
+	entry := QuarantineEntry{
+		QuarantineSummary: quarantineSummary(msg),
+		Headers:           make([]QuarantineHeader, len(msg.Headers)),
+	}
+	if utf8.Valid(msg.Value) {
+		entry.Payload = string(msg.Value)
+		entry.PayloadEncoding = "utf-8"
+	} else {
+		entry.Payload = base64.StdEncoding.EncodeToString(msg.Value)
+		entry.PayloadEncoding = "base64"
+	}
+	for i, header := range msg.Headers {
+		entry.Headers[i] = QuarantineHeader{Key: header.Key, Value: string(header.Value)}
+	}
+	return entry
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"l0/internal/db"
+	"l0/internal/kafka"
+	"l0/internal/validation"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type MockQuarantineStore struct {
+	messages map[int64]db.QuarantinedMessage
+	listFn   func(ctx context.Context, afterID int64, limit int) ([]db.QuarantinedMessage, error)
+}
+
+func (m *MockQuarantineStore) Quarantine(ctx context.Context, msg db.QuarantinedMessage) error {
+	m.messages[msg.ID] = msg
+	return nil
+}
+
+func (m *MockQuarantineStore) ListQuarantined(ctx context.Context, afterID int64, limit int) ([]db.QuarantinedMessage, error) {
+	return m.listFn(ctx, afterID, limit)
+}
+
+func (m *MockQuarantineStore) GetQuarantined(ctx context.Context, id int64) (*db.QuarantinedMessage, error) {
+	msg, ok := m.messages[id]
+	if !ok {
+		return nil, db.ErrNotQuarantined
+	}
+	return &msg, nil
+}
+
+func (m *MockQuarantineStore) DeleteQuarantined(ctx context.Context, id int64) error {
+	if _, ok := m.messages[id]; !ok {
+		return db.ErrNotQuarantined
+	}
+	delete(m.messages, id)
+	return nil
+}
+
+func newQuarantineHandler(consumer *MockConsumerAdmin, store *MockQuarantineStore) *AdminHandler {
+	return NewAdminHandler(consumer, store, "secret", log.New(io.Discard, "", 0))
+}
+
+func TestAdminHandler_ListQuarantine(t *testing.T) {
+	var gotAfterID int64
+	var gotLimit int
+	store := &MockQuarantineStore{
+		listFn: func(ctx context.Context, afterID int64, limit int) ([]db.QuarantinedMessage, error) {
+			gotAfterID, gotLimit = afterID, limit
+			return []db.QuarantinedMessage{{ID: 11, Key: []byte("a")}, {ID: 12, Key: []byte("b")}}, nil
+		},
+	}
+	h := newQuarantineHandler(&MockConsumerAdmin{}, store)
+
+	rec := adminRequest(h, http.MethodGet, "/admin/quarantine?limit=2&after_id=10", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v: %v", rec.Code, rec.Body.String())
+	}
+	if gotAfterID != 10 || gotLimit != 2 {
+		t.Errorf("Unexpected paging passed to store: after_id=%v limit=%v", gotAfterID, gotLimit)
+	}
+
+	var list QuarantineList
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list.Messages) != 2 || list.Messages[1].Key != "b" || list.NextAfterID != 12 {
+		t.Errorf("Unexpected list: %+v", list)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/quarantine?limit=0", "secret", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for zero limit, got %v", rec.Code)
+	}
+}
+
+func TestAdminHandler_GetQuarantined(t *testing.T) {
+	store := &MockQuarantineStore{messages: map[int64]db.QuarantinedMessage{
+		1: {ID: 1, Value: []byte(`{"order_uid":1}`), Headers: []db.MessageHeader{{Key: "event-id", Value: []byte("e1")}}},
+		2: {ID: 2, Value: []byte{0, 0xff, 0xfe}},
+	}}
+	h := newQuarantineHandler(&MockConsumerAdmin{}, store)
+
+	rec := adminRequest(h, http.MethodGet, "/admin/quarantine/1", "secret", "")
+	var entry QuarantineEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if entry.Payload != `{"order_uid":1}` || entry.PayloadEncoding != "utf-8" || entry.Headers[0].Value != "e1" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/quarantine/2", "secret", "")
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if entry.PayloadEncoding != "base64" || entry.Payload != "AP/+" {
+		t.Errorf("Binary payload must be base64 encoded, got %+v", entry)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/quarantine/3", "secret", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown id, got %v", rec.Code)
+	}
+}
+
+func TestAdminHandler_ReprocessQuarantined(t *testing.T) {
+	store := &MockQuarantineStore{messages: map[int64]db.QuarantinedMessage{
+		1: {ID: 1, Value: []byte("broken"), Headers: []db.MessageHeader{{Key: "content-type", Value: []byte("application/avro")}}},
+	}}
+	var got db.QuarantinedMessage
+	consumer := &MockConsumerAdmin{
+		reprocessFn: func(ctx context.Context, entry db.QuarantinedMessage) (string, error) {
+			got = entry
+			if string(entry.Value) == "broken" {
+				return "", &kafka.ProcessingError{Class: kafka.ErrorClassDecode, Err: errors.New("invalid character")}
+			}
+			if string(entry.Value) == `{"order_uid":""}` {
+				return "", &kafka.ProcessingError{Class: kafka.ErrorClassValidate, Err: validation.Errors{
+					{Field: "order_uid", Rule: "required", Message: "order_uid обязательное поле"},
+				}}
+			}
+			return "saved", nil
+		},
+	}
+	h := newQuarantineHandler(consumer, store)
+
+	// Без исправления сообщение снова не проходит и остаётся в карантине
+	rec := adminRequest(h, http.MethodPost, "/admin/quarantine/1/reprocess", "secret", "")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"error_class":"decode"`) {
+		t.Fatalf("Expected 422 with error class, got %v: %v", rec.Code, rec.Body.String())
+	}
+	if _, ok := store.messages[1]; !ok {
+		t.Fatal("Message must stay in quarantine after failed reprocess")
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/admin/quarantine/1/reprocess", "secret", `{"payload":{"order_uid":""}}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"fields":[{"field":"order_uid","rule":"required"`) {
+		t.Fatalf("Expected 422 with field errors, got %v: %v", rec.Code, rec.Body.String())
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/admin/quarantine/1/reprocess", "secret", `{"payload":{"order_uid":"fixed"}}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"result":"saved"`) {
+		t.Fatalf("Expected 200 with result, got %v: %v", rec.Code, rec.Body.String())
+	}
+	if string(got.Value) != `{"order_uid":"fixed"}` || len(got.Headers) != 1 || string(got.Headers[0].Value) != kafka.ContentTypeJSON {
+		t.Errorf("Edited payload must be reprocessed as JSON, got %+v", got)
+	}
+	if _, ok := store.messages[1]; ok {
+		t.Error("Message must be removed from quarantine after successful reprocess")
+	}
+}
+
+func TestAdminHandler_DiscardQuarantined(t *testing.T) {
+	store := &MockQuarantineStore{messages: map[int64]db.QuarantinedMessage{1: {ID: 1}}}
+	h := newQuarantineHandler(&MockConsumerAdmin{}, store)
+
+	rec := adminRequest(h, http.MethodDelete, "/admin/quarantine/1", "secret", "")
+	if rec.Code != http.StatusNoContent || len(store.messages) != 0 {
+		t.Fatalf("Expected message to be discarded, got %v", rec.Code)
+	}
+
+	rec = adminRequest(h, http.MethodDelete, "/admin/quarantine/1", "secret", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for already discarded message, got %v", rec.Code)
+	}
+	rec = adminRequest(h, http.MethodDelete, "/admin/quarantine/1", "", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %v", rec.Code)
+	}
+}
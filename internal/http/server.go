@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -15,6 +16,7 @@ import (
 type Server struct {
 	cache  cache.CacheRepository
 	repo   db.OrderStore
+	mux    *http.ServeMux
 	server *http.Server
 	logger *log.Logger
 }
@@ -25,6 +27,7 @@ func NewServer(port int, cache cache.CacheRepository, repo db.OrderStore, logger
 	s := &Server{
 		cache:  cache,
 		repo:   repo,
+		mux:    mux,
 		logger: logger,
 	}
 
@@ -60,17 +63,23 @@ func (s *Server) handleGetOrder(w http.ResponseWriter, r *http.Request) {
 	if !found {
 		s.logger.Printf("Заказ %v не найден в кэше, запрашиваем в БД", orderUID)
 
-		// Если нет в кэше, ищем в БД
+		// Если нет в кэше, ищем в БД. Номер записи в кэш снимается до чтения,
+		// чтобы не вернуть в кэш заказ, который консьюмер тем временем удалил или обновил
+		generation := s.cache.Generation(orderUID)
 		dbOrder, err := s.repo.GetOrderByID(r.Context(), orderUID)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Заказ не найден", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			s.logger.Printf("Ошибка получения заказа %v из БД: %v", orderUID, err)
-			http.Error(w, "Заказ не найден", http.StatusNotFound)
+			writeStoreError(w, err, "Не удалось получить заказ")
 			return
 		}
 
 		// Добавляем в кэш для будущих запросов
 		order = *dbOrder
-		s.cache.SetOrder(order)
+		s.cache.SetOrderIfUnchanged(order, generation)
 	}
 
 	// Установка заголовков
@@ -83,6 +92,27 @@ func (s *Server) handleGetOrder(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Ответ на ошибку хранилища: 404 для ErrNotFound, 409 для ErrConflict,
+// 503 с Retry-After для ErrUnavailable, иначе 500
+func writeStoreError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, message, http.StatusNotFound)
+	case errors.Is(err, db.ErrConflict):
+		http.Error(w, message, http.StatusConflict)
+	case errors.Is(err, db.ErrUnavailable):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, message, http.StatusServiceUnavailable)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// Регистрация дополнительного обработчика (метрики, служебные эндпоинты)
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 func (s *Server) Start() error {
 	s.logger.Printf("Запуск сервера на порте %v", s.server.Addr)
 	return s.server.ListenAndServe()
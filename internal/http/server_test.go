@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"l0/internal/cache"
+	"l0/internal/db"
+	"l0/internal/model"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockOrderStore struct {
+	getOrderByIDFn func(ctx context.Context, orderUID string) (*model.Order, error)
+}
+
+func (m *MockOrderStore) SaveOrder(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+	return nil
+}
+
+func (m *MockOrderStore) SaveOrders(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error) {
+	return make([]db.SaveStatus, len(orders)), nil
+}
+
+func (m *MockOrderStore) DeleteOrder(ctx context.Context, orderUID string, version int64, refs ...db.MessageRef) error {
+	return nil
+}
+
+func (m *MockOrderStore) GetOrderByID(ctx context.Context, orderUID string) (*model.Order, error) {
+	return m.getOrderByIDFn(ctx, orderUID)
+}
+
+func (m *MockOrderStore) GetAllOrders(ctx context.Context) (map[string]model.Order, error) {
+	return map[string]model.Order{}, nil
+}
+
+func (m *MockOrderStore) IterateOrders(ctx context.Context, filter db.OrderFilter, fn func(model.Order) error) error {
+	return nil
+}
+
+func (m *MockOrderStore) ForgetMessages(ctx context.Context, topic string, partition int, from, to int64) (int64, error) {
+	return 0, nil
+}
+
+func TestServer_GetOrder_MapsStoreErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", fmt.Errorf("order missing: %w", db.ErrNotFound), http.StatusNotFound},
+		{"unavailable", fmt.Errorf("%w: connection refused", db.ErrUnavailable), http.StatusServiceUnavailable},
+		{"unexpected", errors.New("failed to scan orders"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		store := &MockOrderStore{getOrderByIDFn: func(ctx context.Context, orderUID string) (*model.Order, error) {
+			return nil, tt.err
+		}}
+		s := NewServer(0, cache.NewCache(10), store, log.New(io.Discard, "", 0))
+
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/missing", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, rec.Code)
+		}
+		if tt.want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected Retry-After header", tt.name)
+		}
+	}
+}
+
+func TestServer_GetOrder_CachesLoadedOrder(t *testing.T) {
+	calls := 0
+	store := &MockOrderStore{getOrderByIDFn: func(ctx context.Context, orderUID string) (*model.Order, error) {
+		calls++
+		return &model.Order{OrderUID: orderUID}, nil
+	}}
+	s := NewServer(0, cache.NewCache(10), store, log.New(io.Discard, "", 0))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/o-1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", rec.Code)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Second request must be served from cache, store called %v times", calls)
+	}
+}
+
+func TestServer_GetOrder_DoesNotCacheOrderDeletedDuringRead(t *testing.T) {
+	cached := cache.NewCache(10)
+	store := &MockOrderStore{getOrderByIDFn: func(ctx context.Context, orderUID string) (*model.Order, error) {
+		// Консьюмер удаляет заказ, пока запрос читает его из БД
+		cached.DeleteOrder(orderUID)
+		return &model.Order{OrderUID: orderUID}, nil
+	}}
+	s := NewServer(0, cached, store, log.New(io.Discard, "", 0))
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/o-1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v", rec.Code)
+	}
+	if _, ok := cached.GetOrder("o-1"); ok {
+		t.Error("Order deleted during the read must not be cached")
+	}
+}
@@ -0,0 +1,437 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrNotPaused — смещения можно сбрасывать только у приостановленного консьюмера
+var ErrNotPaused = errors.New("consumer must be paused to reset offsets")
+
+// Куда сбрасываются смещения группы
+type OffsetResetMode string
+
+const (
+	ResetToEarliest  OffsetResetMode = "earliest"
+	ResetToLatest    OffsetResetMode = "latest"
+	ResetToTimestamp OffsetResetMode = "timestamp"
+	ResetToOffset    OffsetResetMode = "offset"
+)
+
+type OffsetReset struct {
+	Mode      OffsetResetMode
+	Timestamp time.Time // для timestamp: первое сообщение не раньше этого времени
+	Offset    int64     // для offset: следующее читаемое смещение
+	Partition *int      // для offset: одна партиция, nil — все
+}
+
+func (r OffsetReset) Validate() error {
+	switch r.Mode {
+	case ResetToEarliest, ResetToLatest:
+	case ResetToTimestamp:
+		if r.Timestamp.IsZero() {
+			return errors.New("timestamp is required to reset offsets to a timestamp")
+		}
+	case ResetToOffset:
+		if r.Offset < 0 {
+			return fmt.Errorf("offset must not be negative, got %v", r.Offset)
+		}
+	default:
+		return fmt.Errorf("offset reset mode must be one of %v, %v, %v, %v, got %q",
+			ResetToEarliest, ResetToLatest, ResetToTimestamp, ResetToOffset, r.Mode)
+	}
+	if r.Partition != nil && r.Mode != ResetToOffset {
+		return fmt.Errorf("partition can only be set for %v reset", ResetToOffset)
+	}
+	return nil
+}
+
+// groupOffsetAdmin — вычисление и запись смещений группы в брокере. В тестах подменяется
+type groupOffsetAdmin interface {
+	ResolveOffsets(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error)
+	CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error)
+	CommitOffsets(ctx context.Context, groupID, topic string, offsets map[int]int64) error
+}
+
+type brokerOffsetAdmin struct {
+	client *kafka.Client
+}
+
+func newBrokerOffsetAdmin(brokers []string, security SecurityConfig) (*brokerOffsetAdmin, error) {
+	transport, err := security.transport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure admin transport: %w", err)
+	}
+	return &brokerOffsetAdmin{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(brokers...),
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		},
+	}, nil
+}
+
+func (a *brokerOffsetAdmin) ResolveOffsets(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error) {
+	if reset.Mode == ResetToOffset && reset.Partition != nil {
+		return map[int]int64{*reset.Partition: reset.Offset}, nil
+	}
+
+	partitions, err := a.partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	switch reset.Mode {
+	case ResetToOffset:
+		for _, p := range partitions {
+			offsets[p] = reset.Offset
+		}
+		return offsets, nil
+	case ResetToEarliest:
+		return a.listOffsets(ctx, topic, partitions, kafka.FirstOffsetOf)
+	case ResetToLatest:
+		return a.listOffsets(ctx, topic, partitions, kafka.LastOffsetOf)
+	}
+
+	offsets, err = a.listOffsets(ctx, topic, partitions, func(p int) kafka.OffsetRequest {
+		return kafka.TimeOffsetOf(p, reset.Timestamp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Если сообщений не раньше этого времени нет, брокер возвращает -1: читаем с конца
+	var tail []int
+	for p, offset := range offsets {
+		if offset < 0 {
+			tail = append(tail, p)
+		}
+	}
+	if len(tail) > 0 {
+		last, err := a.listOffsets(ctx, topic, tail, kafka.LastOffsetOf)
+		if err != nil {
+			return nil, err
+		}
+		for p, offset := range last {
+			offsets[p] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// Номера партиций топика
+func (a *brokerOffsetAdmin) partitions(ctx context.Context, topic string) ([]int, error) {
+	meta, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 {
+		return nil, fmt.Errorf("topic %v not found", topic)
+	}
+	if meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: %w", meta.Topics[0].Error)
+	}
+
+	partitions := make([]int, len(meta.Topics[0].Partitions))
+	for i, p := range meta.Topics[0].Partitions {
+		partitions[i] = p.ID
+	}
+	sort.Ints(partitions)
+	return partitions, nil
+}
+
+// Смещения партиций по одному запросу на партицию (повторы партиций брокер не принимает)
+func (a *brokerOffsetAdmin) listOffsets(ctx context.Context, topic string, partitions []int, request func(partition int) kafka.OffsetRequest) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		requests[i] = request(p)
+	}
+
+	resp, err := a.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of partition %v: %w", p.Partition, p.Error)
+		}
+		switch {
+		case p.FirstOffset >= 0:
+			offsets[p.Partition] = p.FirstOffset
+		case p.LastOffset >= 0:
+			offsets[p.Partition] = p.LastOffset
+		default:
+			offsets[p.Partition] = -1
+			for offset := range p.Offsets {
+				offsets[p.Partition] = offset
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// Текущие смещения группы; -1 — группа ещё ничего не подтверждала в партиции
+func (a *brokerOffsetAdmin) CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error) {
+	resp, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", resp.Error)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch committed offset of partition %v: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p.CommittedOffset
+	}
+	return offsets, nil
+}
+
+// Коммит без generation и member ID брокер принимает только от пустой группы,
+// поэтому перед сбросом консьюмер покидает группу
+func (a *brokerOffsetAdmin) CommitOffsets(ctx context.Context, groupID, topic string, offsets map[int]int64) error {
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offset})
+	}
+
+	resp, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+
+	var errs []error
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to commit offset of partition %v: %w", p.Partition, p.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Состояние паузы консьюмера и запросы на сброс смещений, которые выполняет цикл Start
+type consumerControl struct {
+	mu          sync.Mutex
+	paused      bool
+	resumed     chan struct{} // закрывается при возобновлении
+	cancelFetch context.CancelFunc
+	resets      chan resetRequest
+}
+
+type resetRequest struct {
+	ctx   context.Context
+	reset OffsetReset
+	done  chan error
+}
+
+func newConsumerControl() *consumerControl {
+	return &consumerControl{
+		resumed: make(chan struct{}),
+		resets:  make(chan resetRequest),
+	}
+}
+
+func (c *consumerControl) pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.resumed = make(chan struct{})
+	// Прерывание ожидающего FetchMessage: полученное, но не отданное сообщение
+	// остаётся в очереди reader
+	if c.cancelFetch != nil {
+		c.cancelFetch()
+	}
+	return true
+}
+
+func (c *consumerControl) resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	close(c.resumed)
+	return true
+}
+
+func (c *consumerControl) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// Канал, который закроется при возобновлении, и признак паузы
+func (c *consumerControl) pauseState() (<-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed, c.paused
+}
+
+// Контекст одного FetchMessage, который отменяется при постановке на паузу
+func (c *consumerControl) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	fetchCtx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		cancel()
+	}
+	c.cancelFetch = cancel
+	return fetchCtx, cancel
+}
+
+// Приостановка чтения. Сообщения, уже переданные воркерам, дообрабатываются
+func (c *Consumer) Pause() {
+	if c.control.pause() {
+		c.logger.Println("Консьюмер приостановлен")
+	}
+}
+
+func (c *Consumer) Resume() {
+	if c.control.resume() {
+		c.logger.Println("Консьюмер возобновлён")
+	}
+}
+
+func (c *Consumer) Paused() bool {
+	return c.control.isPaused()
+}
+
+// Сброс смещений группы. Выполняется циклом Start: он дожидается воркеров,
+// покидает группу, записывает новые смещения и подключается заново.
+// Консьюмер должен быть на паузе и остаётся на ней после сброса. Весь сброс,
+// включая ожидание воркеров, ограничен ctx
+func (c *Consumer) ResetOffsets(ctx context.Context, reset OffsetReset) error {
+	if err := reset.Validate(); err != nil {
+		return err
+	}
+	if !c.Paused() {
+		return ErrNotPaused
+	}
+
+	req := resetRequest{ctx: ctx, reset: reset, done: make(chan error, 1)}
+	select {
+	case c.control.resets <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Остановка воркеров перед сбросом. На паузе новые сообщения не приходят, но воркер
+// может минутами повторять сохранение при недоступной БД. Дообработка получает
+// не больше половины оставшегося у ctx времени (без дедлайна — DrainTimeout),
+// вторая половина остаётся самому сбросу. Прерванные сообщения не подтверждаются,
+// и после сброса их судьбу решают новые смещения
+func (c *Consumer) stopForReset(ctx context.Context, pool *workerPool, cancelPool context.CancelFunc) {
+	timeout := c.drainTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = max(time.Until(deadline)/2, 0)
+	}
+	if !pool.drain(timeout, cancelPool) {
+		c.logger.Printf("Воркеры не завершили обработку за %v, обработка прервана для сброса смещений", timeout)
+	}
+}
+
+// Выполнение сброса в цикле Start, когда воркеры уже остановлены
+func (c *Consumer) resetOffsets(ctx context.Context, reset OffsetReset) error {
+	if !c.Paused() {
+		return ErrNotPaused
+	}
+	if c.admin == nil || c.newReader == nil {
+		return errors.New("offset reset is not configured")
+	}
+
+	c.logger.Printf("Сброс смещений группы %v топика %v: %v", c.groupID, c.topic, reset.Mode)
+
+	// Reader покидает группу, иначе брокер не примет коммит без generation
+	if err := c.currentReader().Close(); err != nil {
+		c.logger.Printf("Ошибка закрытия reader перед сбросом смещений: %v", err)
+	}
+
+	offsets, err := c.admin.ResolveOffsets(ctx, c.topic, reset)
+	if err == nil {
+		err = c.forgetReplayed(ctx, offsets)
+	}
+	if err == nil {
+		err = c.admin.CommitOffsets(ctx, c.groupID, c.topic, offsets)
+	}
+
+	// Reader пересоздаётся в любом случае, чтобы консьюмер можно было возобновить
+	reader, readerErr := c.newReader()
+	if readerErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to recreate reader: %w", readerErr))
+	}
+	c.setReader(reader)
+	c.offsets.reset()
+	c.metrics.ObserveUncommitted(c.topic, 0)
+
+	if err != nil {
+		return err
+	}
+	c.logger.Printf("Смещения группы %v сброшены: %v", c.groupID, offsets)
+	return nil
+}
+
+// Сообщения между новым и прежним подтверждённым смещением уже есть в журнале
+// обработанных сообщений, и без очистки журнала повторное чтение отбросило бы их
+// как дубликаты. Журнал чистится до коммита смещений: если коммит не пройдёт,
+// группа останется на прежнем смещении и эти сообщения не будут прочитаны снова
+func (c *Consumer) forgetReplayed(ctx context.Context, offsets map[int]int64) error {
+	partitions := make([]int, 0, len(offsets))
+	for p := range offsets {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+
+	committed, err := c.admin.CommittedOffsets(ctx, c.groupID, c.topic, partitions)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		from, to := offsets[p], committed[p]
+		if from < 0 || to <= from {
+			continue
+		}
+		forgotten, err := c.repo.ForgetMessages(ctx, c.topic, p, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to clear ledger of partition %v: %w", p, err)
+		}
+		c.logger.Printf("Партиция %v: смещения %v..%v будут прочитаны повторно, из журнала удалено записей: %v",
+			p, from, to-1, forgotten)
+	}
+	return nil
+}
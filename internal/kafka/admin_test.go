@@ -0,0 +1,270 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"l0/internal/db"
+	"l0/internal/model"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type MockOffsetAdmin struct {
+	resolveFn   func(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error)
+	committedFn func(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error)
+	committed   map[int]int64
+	groupID     string
+}
+
+func (m *MockOffsetAdmin) ResolveOffsets(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error) {
+	if m.resolveFn != nil {
+		return m.resolveFn(ctx, topic, reset)
+	}
+	return map[int]int64{0: 0}, nil
+}
+
+func (m *MockOffsetAdmin) CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error) {
+	if m.committedFn != nil {
+		return m.committedFn(ctx, groupID, topic, partitions)
+	}
+	return map[int]int64{}, nil
+}
+
+func (m *MockOffsetAdmin) CommitOffsets(ctx context.Context, groupID, topic string, offsets map[int]int64) error {
+	m.groupID = groupID
+	m.committed = offsets
+	return nil
+}
+
+func TestOffsetReset_Validate(t *testing.T) {
+	partition := 1
+	tests := []struct {
+		name    string
+		reset   OffsetReset
+		wantErr bool
+	}{
+		{"earliest", OffsetReset{Mode: ResetToEarliest}, false},
+		{"latest", OffsetReset{Mode: ResetToLatest}, false},
+		{"timestamp", OffsetReset{Mode: ResetToTimestamp, Timestamp: time.Now()}, false},
+		{"timestamp without time", OffsetReset{Mode: ResetToTimestamp}, true},
+		{"offset for partition", OffsetReset{Mode: ResetToOffset, Offset: 10, Partition: &partition}, false},
+		{"negative offset", OffsetReset{Mode: ResetToOffset, Offset: -1}, true},
+		{"partition for latest", OffsetReset{Mode: ResetToLatest, Partition: &partition}, true},
+		{"unknown mode", OffsetReset{Mode: "middle"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.reset.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConsumer_ResetOffsetsRequiresPause(t *testing.T) {
+	c, _, _ := newTestConsumer(&MockOrderStore{}, &MockMessageWriter{})
+
+	err := c.ResetOffsets(context.Background(), OffsetReset{Mode: ResetToEarliest})
+	if !errors.Is(err, ErrNotPaused) {
+		t.Errorf("Expected ErrNotPaused, got %v", err)
+	}
+}
+
+func TestConsumer_PauseAndResetOffsets(t *testing.T) {
+	c, oldReader, _ := newTestConsumer(&MockOrderStore{}, &MockMessageWriter{})
+	admin := &MockOffsetAdmin{
+		resolveFn: func(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error) {
+			return map[int]int64{0: 5, 1: 7}, nil
+		},
+	}
+	newReader := &MockMessageReader{}
+	c.admin = admin
+	c.topic = "orders"
+	c.groupID = "order-service"
+	c.newReader = func() (MessageReader, error) { return newReader, nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	c.Pause()
+	if !c.Paused() {
+		t.Fatal("Consumer should be paused")
+	}
+
+	resetCtx, resetCancel := context.WithTimeout(context.Background(), time.Second)
+	defer resetCancel()
+	if err := c.ResetOffsets(resetCtx, OffsetReset{Mode: ResetToEarliest}); err != nil {
+		t.Fatalf("Unexpected reset error: %v", err)
+	}
+
+	if admin.groupID != "order-service" || admin.committed[0] != 5 || admin.committed[1] != 7 {
+		t.Errorf("Unexpected committed offsets for group %v: %v", admin.groupID, admin.committed)
+	}
+	if c.currentReader() != newReader || c.currentReader() == oldReader {
+		t.Error("Reader should be recreated after reset")
+	}
+	if !c.Paused() {
+		t.Error("Consumer should stay paused after reset")
+	}
+
+	c.Resume()
+	if c.Paused() {
+		t.Error("Consumer should be resumed")
+	}
+}
+
+func TestConsumer_ResetOffsetsReprocessesLedgeredMessages(t *testing.T) {
+	msg := newTestMessage(t, "order-1")
+	msg.Partition, msg.Offset = 0, 3
+
+	// Журнал обработанных сообщений: смещение 3 уже обработано до сброса
+	var mu sync.Mutex
+	ledger := map[int64]bool{3: true}
+	saved := make(chan error, 1)
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			mu.Lock()
+			defer mu.Unlock()
+			var err error
+			for _, ref := range refs {
+				if ledger[ref.Offset] {
+					err = db.ErrDuplicate
+				}
+				ledger[ref.Offset] = true
+			}
+			saved <- err
+			return err
+		},
+		forgetFn: func(ctx context.Context, topic string, partition int, from, to int64) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if topic != "orders" || partition != 0 || from != 2 || to != 5 {
+				t.Errorf("Unexpected ledger range %v/%v [%v, %v)", topic, partition, from, to)
+			}
+			var forgotten int64
+			for offset := range ledger {
+				if offset >= from && offset < to {
+					delete(ledger, offset)
+					forgotten++
+				}
+			}
+			return forgotten, nil
+		},
+	}
+
+	c, _, _ := newTestConsumer(store, &MockMessageWriter{})
+	c.admin = &MockOffsetAdmin{
+		resolveFn: func(ctx context.Context, topic string, reset OffsetReset) (map[int]int64, error) {
+			return map[int]int64{0: 2}, nil
+		},
+		committedFn: func(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error) {
+			return map[int]int64{0: 5}, nil
+		},
+	}
+	c.topic = "orders"
+	c.groupID = "order-service"
+
+	var fetched atomic.Bool
+	newReader := &MockMessageReader{
+		fetchFn: func(ctx context.Context) (kafka.Message, error) {
+			if fetched.CompareAndSwap(false, true) {
+				return msg, nil
+			}
+			<-ctx.Done()
+			return kafka.Message{}, ctx.Err()
+		},
+	}
+	c.newReader = func() (MessageReader, error) { return newReader, nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	c.Pause()
+	resetCtx, resetCancel := context.WithTimeout(context.Background(), time.Second)
+	defer resetCancel()
+	if err := c.ResetOffsets(resetCtx, OffsetReset{Mode: ResetToOffset, Offset: 2}); err != nil {
+		t.Fatalf("Unexpected reset error: %v", err)
+	}
+	c.Resume()
+
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Errorf("Replayed message should be saved again, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Replayed message was not processed")
+	}
+}
+
+func TestConsumer_ResetOffsetsInterruptsStuckWorker(t *testing.T) {
+	// Воркер повторяет сохранение, пока его контекст не отменят
+	started := make(chan struct{})
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	c, _, _ := newTestConsumer(store, &MockMessageWriter{})
+	admin := &MockOffsetAdmin{}
+	c.admin = admin
+	c.topic = "orders"
+	c.groupID = "order-service"
+	c.drainTimeout = time.Minute
+	c.newReader = func() (MessageReader, error) { return &MockMessageReader{}, nil }
+	c.setReader(newSingleMessageReader(newTestMessage(t, "order-1")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Message was not dispatched to a worker")
+	}
+	c.Pause()
+
+	resetCtx, resetCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer resetCancel()
+	begin := time.Now()
+	if err := c.ResetOffsets(resetCtx, OffsetReset{Mode: ResetToEarliest}); err != nil {
+		t.Fatalf("Unexpected reset error: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 200*time.Millisecond {
+		t.Errorf("Reset must fit into its context deadline, took %v", elapsed)
+	}
+	if admin.committed == nil {
+		t.Error("Offsets should be committed after the stuck worker is interrupted")
+	}
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"l0/internal/model"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// Декодер Avro в Confluent wire format. Схема заказа должна повторять JSON-контракт:
+// те же имена полей, date_created — строка в RFC 3339
+type AvroDecoder struct {
+	registry SchemaRegistry
+	codecs   *schemaCache[*goavro.Codec]
+}
+
+func NewAvroDecoder(registry SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{
+		registry: registry,
+		codecs:   newSchemaCache[*goavro.Codec](),
+	}
+}
+
+func (d *AvroDecoder) Decode(ctx context.Context, msg kafka.Message) (model.Order, error) {
+	schemaID, body, err := parseWireFormat(msg.Value)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	codec, err := d.codec(ctx, schemaID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	native, _, err := codec.NativeFromBinary(body)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to decode avro message: %w", err)
+	}
+
+	// Кодек для стандартного JSON не оборачивает union-значения в {"тип": значение}
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("failed to convert avro message: %w", err)
+	}
+
+	var order model.Order
+	if err := json.Unmarshal(textual, &order); err != nil {
+		return model.Order{}, fmt.Errorf("failed to convert avro message: %w", err)
+	}
+	return order, nil
+}
+
+func (d *AvroDecoder) codec(ctx context.Context, schemaID int) (*goavro.Codec, error) {
+	return d.codecs.get(ctx, schemaID, func(ctx context.Context) (*goavro.Codec, error) {
+		return d.loadCodec(ctx, schemaID)
+	})
+}
+
+func (d *AvroDecoder) loadCodec(ctx context.Context, schemaID int) (*goavro.Codec, error) {
+	schema, err := d.registry.GetSchema(ctx, schemaID)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != SchemaTypeAvro {
+		return nil, fmt.Errorf("schema %v is %v, not avro", schemaID, schema.Type)
+	}
+
+	codec, err := goavro.NewCodecForStandardJSONFull(schema.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema %v: %w", schemaID, err)
+	}
+	return codec, nil
+}
@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	StartOffsetEarliest = "earliest"
+	StartOffsetLatest   = "latest"
+)
+
+// Настройки консьюмера заказов
+type Config struct {
+	Brokers           []string
+	Topic             string
+	GroupID           string
+	StartOffset       string // earliest или latest — откуда читать, если у группы нет смещения
+	MinBytes          int
+	MaxBytes          int
+	MaxWait           time.Duration
+	CommitInterval    time.Duration // 0 — синхронный коммит после каждой обработки
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+	Security          SecurityConfig
+
+	DLQTopic  string // пустой — DLQ отключена
+	Workers   int
+	BatchSize int
+	BatchWait time.Duration
+	Retry     RetryPolicy
+	// Сколько при остановке ждать, пока воркеры дообработают полученные сообщения
+	DrainTimeout time.Duration
+	// Сколько полученных сообщений может ждать подтверждения смещения, прежде чем
+	// чтение приостановится
+	MaxUncommitted int
+	// Только для консьюмера статусов: сколько событие ждёт заказ, которого ещё нет в БД
+	MissingItemWait time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Brokers:           []string{"localhost:9092"},
+		Topic:             "orders",
+		GroupID:           "order-service",
+		StartOffset:       StartOffsetEarliest,
+		MinBytes:          10e3, // 10KB
+		MaxBytes:          10e6, // 10MB
+		MaxWait:           10 * time.Second,
+		CommitInterval:    0,
+		SessionTimeout:    30 * time.Second,
+		HeartbeatInterval: 3 * time.Second,
+		DLQTopic:          "orders.dlq",
+		Workers:           4,
+		BatchSize:         1,
+		BatchWait:         200 * time.Millisecond,
+		Retry:             DefaultRetryPolicy(),
+		DrainTimeout:      30 * time.Second,
+		MaxUncommitted:    10000,
+		MissingItemWait:   5 * time.Second,
+	}
+}
+
+// Разбор списка брокеров через запятую с отбрасыванием пустых элементов
+func ParseBrokers(value string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(value, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// Проверка настроек. Возвращает все найденные проблемы сразу
+func (c Config) Validate() error {
+	var errs []error
+
+	if len(c.Brokers) == 0 {
+		errs = append(errs, errors.New("at least one kafka broker is required"))
+	}
+	for _, broker := range c.Brokers {
+		if !strings.Contains(broker, ":") {
+			errs = append(errs, fmt.Errorf("kafka broker %q must be in host:port form", broker))
+		}
+	}
+	if c.Topic == "" {
+		errs = append(errs, errors.New("kafka topic is required"))
+	}
+	if c.GroupID == "" {
+		errs = append(errs, errors.New("kafka group id is required"))
+	}
+	if c.StartOffset != StartOffsetEarliest && c.StartOffset != StartOffsetLatest {
+		errs = append(errs, fmt.Errorf("kafka start offset must be %q or %q, got %q",
+			StartOffsetEarliest, StartOffsetLatest, c.StartOffset))
+	}
+	if c.MinBytes <= 0 {
+		errs = append(errs, fmt.Errorf("kafka min bytes must be positive, got %v", c.MinBytes))
+	}
+	if c.MaxBytes < c.MinBytes {
+		errs = append(errs, fmt.Errorf("kafka max bytes (%v) must not be less than min bytes (%v)", c.MaxBytes, c.MinBytes))
+	}
+	if c.MaxWait <= 0 {
+		errs = append(errs, fmt.Errorf("kafka max wait must be positive, got %v", c.MaxWait))
+	}
+	if c.CommitInterval < 0 {
+		errs = append(errs, fmt.Errorf("kafka commit interval must not be negative, got %v", c.CommitInterval))
+	}
+	if c.HeartbeatInterval <= 0 || c.SessionTimeout <= c.HeartbeatInterval {
+		errs = append(errs, fmt.Errorf("kafka heartbeat interval (%v) must be positive and less than session timeout (%v)",
+			c.HeartbeatInterval, c.SessionTimeout))
+	}
+	if c.DLQTopic != "" && c.DLQTopic == c.Topic {
+		errs = append(errs, fmt.Errorf("kafka dlq topic must differ from source topic %q", c.Topic))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("kafka workers must be at least 1, got %v", c.Workers))
+	}
+	if c.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("kafka batch size must be at least 1, got %v", c.BatchSize))
+	}
+	if c.BatchSize > 1 && c.BatchWait <= 0 {
+		errs = append(errs, fmt.Errorf("kafka batch wait must be positive, got %v", c.BatchWait))
+	}
+	if c.DrainTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("kafka drain timeout must be positive, got %v", c.DrainTimeout))
+	}
+	if c.MissingItemWait < 0 {
+		errs = append(errs, fmt.Errorf("missing item wait must not be negative, got %v", c.MissingItemWait))
+	}
+	if c.MaxUncommitted < 1 {
+		errs = append(errs, fmt.Errorf("kafka max uncommitted messages must be at least 1, got %v", c.MaxUncommitted))
+	}
+
+	errs = append(errs, c.Security.validate()...)
+
+	return errors.Join(errs...)
+}
+
+func (c Config) readerConfig() (kafka.ReaderConfig, error) {
+	dialer, err := c.Security.dialer()
+	if err != nil {
+		return kafka.ReaderConfig{}, fmt.Errorf("failed to configure kafka dialer: %w", err)
+	}
+
+	startOffset := kafka.FirstOffset
+	if c.StartOffset == StartOffsetLatest {
+		startOffset = kafka.LastOffset
+	}
+
+	return kafka.ReaderConfig{
+		Brokers:           c.Brokers,
+		Topic:             c.Topic,
+		GroupID:           c.GroupID,
+		StartOffset:       startOffset,
+		MinBytes:          c.MinBytes,
+		MaxBytes:          c.MaxBytes,
+		MaxWait:           c.MaxWait,
+		CommitInterval:    c.CommitInterval,
+		SessionTimeout:    c.SessionTimeout,
+		HeartbeatInterval: c.HeartbeatInterval,
+		Dialer:            dialer,
+	}, nil
+}
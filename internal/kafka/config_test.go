@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestParseBrokers(t *testing.T) {
+	brokers := ParseBrokers(" kafka-1:9092, kafka-2:9092,,")
+	if len(brokers) != 2 || brokers[0] != "kafka-1:9092" || brokers[1] != "kafka-2:9092" {
+		t.Errorf("Unexpected brokers: %v", brokers)
+	}
+}
+
+func TestConfig_DefaultIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Default config should be valid, got: %v", err)
+	}
+}
+
+func TestConfig_ValidateReportsAllProblems(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Brokers = []string{"kafka"}
+	cfg.Topic = ""
+	cfg.StartOffset = "middle"
+	cfg.Workers = 0
+	cfg.DrainTimeout = 0
+	cfg.MaxUncommitted = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"host:port", "topic is required", "start offset", "workers", "drain timeout", "max uncommitted"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestConfig_ReaderConfigStartOffset(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StartOffset = StartOffsetLatest
+
+	readerCfg, err := cfg.readerConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := readerCfg.StartOffset; got != kafka.LastOffset {
+		t.Errorf("Expected LastOffset, got %v", got)
+	}
+}
+
+func TestConfig_ValidateSecurity(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Security = SecurityConfig{
+		SASLMechanism: "GSSAPI",
+		TLSCertFile:   "client.pem",
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"sasl mechanism", "tls is not enabled", "certificate and key"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestSecurityConfig_ScramDialer(t *testing.T) {
+	security := SecurityConfig{
+		SASLMechanism: "scram-sha-512",
+		SASLUsername:  "svc",
+		SASLPassword:  "secret",
+		TLSEnabled:    true,
+		TLSServerName: "kafka.internal",
+	}
+
+	dialer, err := security.dialer()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dialer.SASLMechanism == nil || dialer.SASLMechanism.Name() != SASLMechanismScramSHA512 {
+		t.Errorf("Expected SCRAM-SHA-512 mechanism, got %v", dialer.SASLMechanism)
+	}
+	if dialer.TLS == nil || dialer.TLS.ServerName != "kafka.internal" {
+		t.Errorf("Expected TLS with server name override, got %+v", dialer.TLS)
+	}
+}
+
+func TestSecurityConfig_MissingCAFile(t *testing.T) {
+	security := SecurityConfig{TLSEnabled: true, TLSCAFile: "/nonexistent/ca.pem"}
+
+	if _, err := security.dialer(); err == nil {
+		t.Error("Expected error for missing CA file")
+	}
+}
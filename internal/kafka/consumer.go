@@ -2,106 +2,743 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"l0/internal/cache"
 	"l0/internal/db"
+	"l0/internal/metrics"
 	"l0/internal/model"
+	"l0/internal/tracing"
+	"l0/internal/validation"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// Заголовок с ID события от продюсера, по которому распознаются повторные доставки
+	HeaderEventID = "event-id"
+	// Заголовок с версией события; имеет приоритет над полем version в теле
+	HeaderEventVersion = "event-version"
+)
+
+// MessageReader — то, что консьюмеру нужно от kafka.Reader. Позволяет подменить брокер в тестах
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Consumer struct {
-	reader       *kafka.Reader
-	repo         db.OrderStore
-	cachedOrders cache.CacheRepository
-	logger       *log.Logger
-	val          *validator.Validate
-}
-
-func NewConsumer(brokers []string, repo db.OrderStore, cachedOrders cache.CacheRepository, validator *validator.Validate, logger *log.Logger) *Consumer {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:   brokers,
-		Topic:     "orders",
-		GroupID:   "order-service",
-		MinBytes:  10e3, // 10KB
-		MaxBytes:  10e6, // 10MB
-		Partition: 0,
-	})
+	reader        MessageReader
+	readerMu      sync.RWMutex
+	newReader     func() (MessageReader, error) // пересоздание reader после сброса смещений
+	admin         groupOffsetAdmin
+	control       *consumerControl
+	topic         string
+	groupID       string
+	repo          db.OrderStore
+	cachedOrders  cache.CacheRepository
+	dlq           *DeadLetterQueue
+	quarantine    db.QuarantineStore
+	decoder       Decoder
+	retry         RetryPolicy
+	rejectRetry   RetryPolicy // запись в карантин или DLQ
+	workers       int
+	batchSize     int
+	batchWait     time.Duration
+	drainTimeout  time.Duration
+	offsets       *offsetTracker
+	maxPending    int  // предел неподтверждённых сообщений, 0 — без ограничения
+	skipLedger    bool // не записывать сообщения в журнал (replay уже обработанных сообщений)
+	duplicates    atomic.Int64
+	staleVersions atomic.Int64
+	metrics       *metrics.ConsumerMetrics
+	logger        *log.Logger
+	val           *validation.Validator
+}
+
+// Период опроса статистики kafka.Reader для метрик
+const readerStatsInterval = 15 * time.Second
+
+// Период обновления метрики простоя смещений партиций
+const commitStallInterval = 15 * time.Second
+
+// Одно из dlq и quarantine может быть nil, но не оба: отклонённые сообщения
+// нужно куда-то сохранить, чтобы подтвердить их смещение
+func NewConsumer(cfg Config, repo db.OrderStore, cachedOrders cache.CacheRepository, dlq *DeadLetterQueue, quarantine db.QuarantineStore, decoder Decoder, validator *validation.Validator, metrics *metrics.ConsumerMetrics, logger *log.Logger) (*Consumer, error) {
+	if dlq == nil && quarantine == nil {
+		return nil, errors.New("consumer requires a dead letter queue or a quarantine store for rejected messages")
+	}
+
+	readerCfg, err := cfg.readerConfig()
+	if err != nil {
+		return nil, err
+	}
+	reader := kafka.NewReader(readerCfg)
+	newReader := func() (MessageReader, error) {
+		return kafka.NewReader(readerCfg), nil
+	}
+
+	admin, err := newBrokerOffsetAdmin(cfg.Brokers, cfg.Security)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder == nil {
+		decoder = JSONDecoder{}
+	}
 
 	return &Consumer{
 		reader:       reader,
+		newReader:    newReader,
+		admin:        admin,
+		control:      newConsumerControl(),
+		topic:        cfg.Topic,
+		groupID:      cfg.GroupID,
 		repo:         repo,
 		cachedOrders: cachedOrders,
+		dlq:          dlq,
+		quarantine:   quarantine,
+		decoder:      decoder,
+		retry:        cfg.Retry,
+		rejectRetry:  rejectPolicy(cfg.Retry),
+		workers:      cfg.Workers,
+		batchSize:    cfg.BatchSize,
+		batchWait:    cfg.BatchWait,
+		drainTimeout: cfg.DrainTimeout,
+		offsets:      newOffsetTracker(),
+		maxPending:   cfg.MaxUncommitted,
+		metrics:      metrics,
 		logger:       logger,
 		val:          validator,
-	}
+	}, nil
 }
 
-func (c *Consumer) Start(ctx context.Context) {
-	c.logger.Println("Запуск консьюмера...")
+// Чтение и обработка сообщений до отмены ctx. После отмены чтение прекращается,
+// воркеры дообрабатывают и подтверждают полученные сообщения (не дольше DrainTimeout),
+// и Start возвращает итог остановки. Reader закрывается вызывающим после возврата
+func (c *Consumer) Start(ctx context.Context) DrainStatus {
+	c.logger.Printf("Запуск консьюмера (воркеров: %v)...", c.workers)
+
+	// Обработка и коммит не прерываются вместе с чтением, их контекст
+	// отменяется, только если дообработка не уложилась в DrainTimeout
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	// У каждого пула свой контекст: при сбросе смещений незавершённую обработку
+	// прерывают, не трогая следующий пул
+	poolCtx, cancelPool := context.WithCancel(workCtx)
+	pool := c.newPool(poolCtx)
+
+	go reportReaderStats(ctx, c.currentReader, c.metrics)
+	go reportCommitStalls(ctx, c.topic, c.offsets, c.metrics)
 
 	for {
 		select {
 		case <-ctx.Done():
-			c.logger.Println("Остановка консьюмера...")
-			return
+			c.logger.Println("Остановка консьюмера: дообработка полученных сообщений...")
+			return c.drain(pool, cancelPool)
 		default:
-			message, err := c.reader.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() == nil {
-					c.logger.Printf("Ошибка чтения сообщения: %v", err)
-				}
-				continue
+		}
+
+		// На паузе сообщения не читаются; здесь же выполняется сброс смещений,
+		// когда воркеры простаивают
+		if resumed, paused := c.control.pauseState(); paused {
+			select {
+			case <-ctx.Done():
+			case <-resumed:
+			case req := <-c.control.resets:
+				c.stopForReset(req.ctx, pool, cancelPool)
+				req.done <- c.resetOffsets(req.ctx, req.reset)
+				poolCtx, cancelPool = context.WithCancel(workCtx)
+				pool = c.newPool(poolCtx)
 			}
+			continue
+		}
 
-			c.logger.Printf("Получено сообщение: offset=%v, time=%v\n", message.Offset, message.Time)
+		// FetchMessage не коммитит смещение сам, коммит делается после обработки.
+		// Пока неподтверждённых сообщений слишком много, новые не читаются
+		fetchCtx, cancel := c.control.fetchContext(ctx)
+		if !c.offsets.waitBelow(fetchCtx, c.maxPending, c.logBackpressure) {
+			cancel()
+			continue
+		}
+		message, err := c.currentReader().FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if fetchCtx.Err() == nil {
+				c.logger.Printf("Ошибка чтения сообщения: %v", err)
+			}
+			continue
+		}
+
+		c.logger.Printf("Получено сообщение: offset=%v, time=%v\n", message.Offset, message.Time)
+
+		// Обработка сообщения в воркере, отвечающем за этот заказ
+		c.metrics.ObserveFetch(message)
+		c.offsets.track(message)
+		c.metrics.ObserveUncommitted(message.Topic, c.offsets.uncommitted())
+		pool.dispatch(ctx, message)
+	}
+}
+
+func (c *Consumer) logBackpressure(uncommitted int) {
+	c.logger.Printf("Неподтверждённых сообщений: %v, чтение приостановлено до подтверждения смещений", uncommitted)
+}
+
+// Итог остановки консьюмера
+type DrainStatus struct {
+	Drained     bool          // воркеры доработали до истечения DrainTimeout
+	Uncommitted int           // полученные сообщения без подтверждённого смещения, они будут прочитаны снова
+	Duration    time.Duration // сколько длилась дообработка
+}
+
+// Дообработка полученных сообщений при остановке
+func (c *Consumer) drain(pool *workerPool, cancelPool context.CancelFunc) DrainStatus {
+	status := drainPool(pool, c.offsets, c.drainTimeout, cancelPool)
+	if !status.Drained {
+		c.logger.Printf("Дообработка не уложилась в %v и прервана", c.drainTimeout)
+	}
+	c.logger.Printf("Консьюмер остановлен за %v, неподтверждённых сообщений: %v", status.Duration, status.Uncommitted)
+	return status
+}
 
-			// Обработка сообщения
-			c.processMessage(ctx, message)
+func drainPool(pool *workerPool, offsets *offsetTracker, timeout time.Duration, cancelWork context.CancelFunc) DrainStatus {
+	started := time.Now()
+	drained := pool.drain(timeout, cancelWork)
+	return DrainStatus{
+		Drained:     drained,
+		Uncommitted: offsets.uncommitted(),
+		Duration:    time.Since(started),
+	}
+}
+
+func (c *Consumer) newPool(ctx context.Context) *workerPool {
+	return newWorkerPool(c.workers, c.batchSize, c.batchWait, func(msgs []kafka.Message) {
+		c.handleBatch(ctx, msgs)
+	})
+}
+
+func (c *Consumer) currentReader() MessageReader {
+	c.readerMu.RLock()
+	defer c.readerMu.RUnlock()
+	return c.reader
+}
+
+func (c *Consumer) setReader(reader MessageReader) {
+	c.readerMu.Lock()
+	defer c.readerMu.Unlock()
+	c.reader = reader
+}
+
+// Обработка пачки сообщений одного воркера и подтверждение тех, что обработаны.
+// Tombstone разбивает пачку: заказы до него сохраняются раньше удаления, после — позже
+func (c *Consumer) handleBatch(ctx context.Context, msgs []kafka.Message) {
+	started := time.Now()
+	done := make([]kafka.Message, 0, len(msgs))
+	start := 0
+	for i, msg := range msgs {
+		if isTombstone(msg) {
+			done = append(done, c.processSegment(ctx, msgs[start:i])...)
+			done = append(done, c.processSegment(ctx, msgs[i:i+1])...)
+			start = i + 1
 		}
 	}
+	done = append(done, c.processSegment(ctx, msgs[start:])...)
+
+	c.commitProcessed(ctx, done...)
+	observeHandled(c.metrics, started, msgs, done)
 }
 
-func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) {
-	var order model.Order
+// Обработка части пачки. Возвращает сообщения, смещения которых можно подтверждать
+func (c *Consumer) processSegment(ctx context.Context, msgs []kafka.Message) []kafka.Message {
+	switch len(msgs) {
+	case 0:
+		return nil
+	case 1:
+		if c.processMessage(ctx, msgs[0]) {
+			return msgs
+		}
+		return nil
+	default:
+		return c.processBatch(ctx, msgs)
+	}
+}
+
+// Обработка сообщения. Возвращает true, если смещение сообщения можно подтверждать:
+// заказ сохранён (или удалён) либо сообщение отправлено в карантин или DLQ
+func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) bool {
+	ctx, span := startMessageSpan(ctx, msg)
+	defer span.End()
+
+	if isTombstone(msg) {
+		return c.deleteOrder(ctx, msg)
+	}
+
+	order, class, err := c.decodeMessage(ctx, msg)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return c.reject(ctx, msg, class, err, 1)
+	}
+
+	return c.saveOrder(ctx, msg, order)
+}
+
+// Обработка пачки: заказы сохраняются одной транзакцией. Если пачку сохранить не удалось,
+// заказы сохраняются по одному, чтобы в DLQ попали только действительно проблемные.
+// Возвращает сообщения, смещения которых можно подтверждать
+func (c *Consumer) processBatch(ctx context.Context, msgs []kafka.Message) []kafka.Message {
+	done := make([]kafka.Message, 0, len(msgs))
+	valid := make([]kafka.Message, 0, len(msgs))
+	orders := make([]model.Order, 0, len(msgs))
+
+	// У каждого сообщения свой спан обработки, а сохранение пачки связано с ними ссылками
+	msgCtxs := make([]context.Context, 0, len(msgs))
+	links := make([]trace.Link, 0, len(msgs))
+	spans := make([]trace.Span, 0, len(msgs))
+	defer func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}()
+
+	for _, msg := range msgs {
+		msgCtx, span := startMessageSpan(ctx, msg)
+		spans = append(spans, span)
+
+		order, class, err := c.decodeMessage(msgCtx, msg)
+		if err != nil {
+			tracing.RecordError(span, err)
+			if c.reject(msgCtx, msg, class, err, 1) {
+				done = append(done, msg)
+			}
+			continue
+		}
+		valid = append(valid, msg)
+		orders = append(orders, order)
+		msgCtxs = append(msgCtxs, msgCtx)
+		links = append(links, trace.LinkFromContext(msgCtx))
+	}
+
+	if len(orders) == 0 {
+		return done
+	}
+
+	var refs []db.MessageRef
+	if !c.skipLedger {
+		refs = make([]db.MessageRef, len(valid))
+		for i, msg := range valid {
+			refs[i] = messageRef(msg)
+		}
+	}
+
+	saveCtx, saveSpan := otel.Tracer(tracerName).Start(ctx, "save batch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("messaging.batch.message_count", len(orders))),
+	)
+	var statuses []db.SaveStatus
+	attempts, err := c.retry.Do(saveCtx, func() error {
+		var err error
+		statuses, err = c.repo.SaveOrders(saveCtx, orders, refs)
+		return err
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Временная ошибка сохранения пачки из %v заказов (попытка %v), повтор через %v: %v",
+			len(orders), attempt, wait, err)
+	})
+	saveSpan.SetAttributes(attribute.Int("retry.attempts", attempts))
+	if err != nil {
+		tracing.RecordError(saveSpan, err)
+	}
+	saveSpan.End()
+	if err != nil {
+		if ctx.Err() != nil {
+			return done
+		}
+		c.logger.Printf("Ошибка сохранения пачки из %v заказов, сохраняем по одному: %v", len(orders), err)
+		for i := range valid {
+			if c.saveOrder(msgCtxs[i], valid[i], orders[i]) {
+				done = append(done, valid[i])
+			}
+		}
+		return done
+	}
 
-	// Десериализация JSON
-	if err := json.Unmarshal(msg.Value, &order); err != nil {
+	// Обновление кэша только теми заказами, которые действительно записаны в БД
+	for i, order := range orders {
+		switch statuses[i] {
+		case db.StatusSaved:
+			c.updateCache(msgCtxs[i], order)
+			c.metrics.Processed(valid[i].Topic, metrics.ResultSaved)
+		case db.StatusDuplicate:
+			c.duplicate(valid[i], order)
+		case db.StatusStale:
+			c.stale(valid[i], order)
+		}
+	}
+
+	c.logger.Printf("Пачка из %v заказов успешно обработана", len(orders))
+	return append(done, valid...)
+}
+
+// Десериализация и валидация сообщения. При ошибке возвращает её класс
+func (c *Consumer) decodeMessage(ctx context.Context, msg kafka.Message) (model.Order, ErrorClass, error) {
+	// Десериализация (JSON, Avro или Protobuf). Недоступность Schema Registry
+	// повторяется так же, как временные ошибки БД
+	decodeCtx, span := startSpan(ctx, "decode")
+	var order model.Order
+	attempts, err := c.retry.Do(decodeCtx, func() error {
+		var err error
+		order, err = c.decoder.Decode(decodeCtx, msg)
+		return err
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Временная ошибка десериализации сообщения partition=%v offset=%v (попытка %v), повтор через %v: %v",
+			msg.Partition, msg.Offset, attempt, wait, err)
+	})
+	span.SetAttributes(attribute.Int("retry.attempts", attempts))
+	if err != nil {
+		tracing.RecordError(span, err)
+		span.End()
 		c.logger.Printf("Ошибка десериализации сообщения: %v. Сообщение: %v", err, string(msg.Value))
-		return
+		return order, ErrorClassDecode, err
 	}
+	span.End()
 
 	// Валидация данных
 	if c.val != nil {
+		_, span := startSpan(ctx, "validate")
 		if err := c.val.Struct(order); err != nil {
-			validationErrors := err.(validator.ValidationErrors)
-			for _, e := range validationErrors {
-				c.logger.Printf("Ошибка валидации в поле '%s': %s (значение: %v)",
-					e.Field(), e.Tag(), e.Value())
+			tracing.RecordError(span, err)
+			span.End()
+			logValidationErrors(c.logger, "Ошибка валидации заказа", err)
+			return order, ErrorClassValidate, err
+		}
+		span.End()
+	}
+
+	order.Version = eventVersion(msg, order)
+
+	return order, "", nil
+}
+
+// Запись в лог каждого нарушения правил валидации
+func logValidationErrors(logger *log.Logger, prefix string, err error) {
+	var fieldErrors validation.Errors
+	if !errors.As(err, &fieldErrors) {
+		logger.Printf("%v: %v", prefix, err)
+		return
+	}
+	for _, e := range fieldErrors {
+		logger.Printf("%v в поле '%v': %v (значение: %v): %v", prefix, e.Field, e.Rule, e.Value, e.Message)
+	}
+}
+
+// Версия события: заголовок, затем поле version в теле, а без них — date_created
+func eventVersion(msg kafka.Message, order model.Order) int64 {
+	if version := headerVersion(msg); version != 0 {
+		return version
+	}
+	if order.Version != 0 {
+		return order.Version
+	}
+	return order.DateCreated.UnixMicro()
+}
+
+// Версия из заголовка сообщения, 0 — заголовка нет или он не число
+func headerVersion(msg kafka.Message) int64 {
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, HeaderEventVersion) {
+			if version, err := strconv.ParseInt(string(h.Value), 10, 64); err == nil {
+				return version
 			}
-			return
 		}
 	}
+	return 0
+}
 
-	// Сохранение в БД
-	if err := c.repo.SaveOrder(ctx, order); err != nil {
+// Сохранение одного заказа в БД и кэш. Возвращает true, если смещение можно подтверждать
+func (c *Consumer) saveOrder(ctx context.Context, msg kafka.Message, order model.Order) bool {
+	attempts, err := c.persistOrder(ctx, msg, order)
+	if errors.Is(err, db.ErrDuplicate) {
+		c.duplicate(msg, order)
+		return true
+	}
+	if errors.Is(err, db.ErrStale) {
+		c.stale(msg, order)
+		return true
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Остановка во время повторов: смещение не коммитим, сообщение будет прочитано снова
+			return false
+		}
 		c.logger.Printf("Ошибка сохранения заказа %v в БД: %v", order.OrderUID, err)
-		return
+		return c.reject(ctx, msg, ErrorClassPersist, err, attempts)
 	}
 
 	// Обновление кэша
+	c.updateCache(ctx, order)
+	c.metrics.Processed(msg.Topic, metrics.ResultSaved)
+
+	c.logger.Printf("Заказ успешно обработан: %v", order.OrderUID)
+	return true
+}
+
+// Сохранение заказа в БД. Временные ошибки повторяются прямо здесь: воркер не берёт
+// следующее сообщение, а смещение партиции не продвигается дальше этого сообщения
+func (c *Consumer) persistOrder(ctx context.Context, msg kafka.Message, order model.Order) (int, error) {
+	saveCtx, span := startSpan(ctx, "save", attribute.String("order.uid", order.OrderUID))
+	attempts, err := c.retry.Do(saveCtx, func() error {
+		return c.repo.SaveOrder(saveCtx, order, c.messageRefs(msg)...)
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Временная ошибка сохранения заказа %v (попытка %v), повтор через %v: %v",
+			order.OrderUID, attempt, wait, err)
+	})
+	endSaveSpan(span, attempts, err)
+	return attempts, err
+}
+
+// Кэш необязателен: у Replayer его нет, заказ загрузится из БД при первом запросе
+func (c *Consumer) updateCache(ctx context.Context, order model.Order) {
+	if c.cachedOrders == nil {
+		return
+	}
+	_, span := startSpan(ctx, "cache update", attribute.String("order.uid", order.OrderUID))
+	defer span.End()
 	c.cachedOrders.SetOrder(order)
+}
 
-	// Подтверждение обработки сообщения
-	if err := c.reader.CommitMessages(ctx, msg); err != nil {
-		c.logger.Printf("Ошибка подтверждения сообщения: %v", err)
+// Итог сохранения в спане: число попыток, а дубликат и устаревшая версия — не ошибки
+func endSaveSpan(span trace.Span, attempts int, err error) {
+	span.SetAttributes(attribute.Int("retry.attempts", attempts))
+	switch {
+	case errors.Is(err, db.ErrDuplicate):
+		span.SetAttributes(attribute.String("order.save.result", metrics.ResultDuplicate))
+	case errors.Is(err, db.ErrStale):
+		span.SetAttributes(attribute.String("order.save.result", metrics.ResultStale))
+	case err != nil:
+		tracing.RecordError(span, err)
 	}
+	span.End()
+}
 
-	c.logger.Printf("Заказ успешно обработан: %v", order.OrderUID)
+// Tombstone — сообщение без тела, означает удаление заказа с order_uid из ключа
+func isTombstone(msg kafka.Message) bool {
+	return msg.Value == nil
+}
+
+// Удаление заказа по tombstone из БД и кэша. Возвращает true, если смещение можно подтверждать
+func (c *Consumer) deleteOrder(ctx context.Context, msg kafka.Message) bool {
+	orderUID := string(msg.Key)
+	if orderUID == "" {
+		c.logger.Printf("Tombstone без ключа: partition=%v offset=%v", msg.Partition, msg.Offset)
+		return c.reject(ctx, msg, ErrorClassDecode, errors.New("tombstone without order_uid key"), 1)
+	}
+
+	attempts, err := c.removeOrder(ctx, msg, orderUID)
+	if errors.Is(err, db.ErrDuplicate) {
+		c.duplicate(msg, model.Order{OrderUID: orderUID})
+		return true
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		c.logger.Printf("Ошибка удаления заказа %v из БД: %v", orderUID, err)
+		return c.reject(ctx, msg, ErrorClassPersist, err, attempts)
+	}
+
+	c.evictCache(ctx, orderUID)
+	c.metrics.Processed(msg.Topic, metrics.ResultDeleted)
+
+	c.logger.Printf("Заказ удалён: %v", orderUID)
+	return true
+}
+
+// Удаление заказа из БД с повтором временных ошибок
+func (c *Consumer) removeOrder(ctx context.Context, msg kafka.Message, orderUID string) (int, error) {
+	deleteCtx, span := startSpan(ctx, "delete", attribute.String("order.uid", orderUID))
+	attempts, err := c.retry.Do(deleteCtx, func() error {
+		return c.repo.DeleteOrder(deleteCtx, orderUID, headerVersion(msg), c.messageRefs(msg)...)
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Временная ошибка удаления заказа %v (попытка %v), повтор через %v: %v",
+			orderUID, attempt, wait, err)
+	})
+	endSaveSpan(span, attempts, err)
+	return attempts, err
+}
+
+func (c *Consumer) evictCache(ctx context.Context, orderUID string) {
+	if c.cachedOrders == nil {
+		return
+	}
+	_, span := startSpan(ctx, "cache update", attribute.String("order.uid", orderUID))
+	defer span.End()
+	c.cachedOrders.DeleteOrder(orderUID)
+}
+
+// Повторная доставка уже обработанного сообщения: заказ не перезаписывается и не кэшируется
+func (c *Consumer) duplicate(msg kafka.Message, order model.Order) {
+	c.duplicates.Add(1)
+	c.metrics.Processed(msg.Topic, metrics.ResultDuplicate)
+	c.logger.Printf("Сообщение partition=%v offset=%v с заказом %v уже обработано, пропускаем",
+		msg.Partition, msg.Offset, order.OrderUID)
+}
+
+// Устаревшая версия заказа: в БД уже более новая, кэш не трогаем
+func (c *Consumer) stale(msg kafka.Message, order model.Order) {
+	c.staleVersions.Add(1)
+	c.metrics.Processed(msg.Topic, metrics.ResultStale)
+	c.logger.Printf("Сообщение partition=%v offset=%v содержит устаревшую версию %v заказа %v, пропускаем",
+		msg.Partition, msg.Offset, order.Version, order.OrderUID)
+}
+
+// Ссылки на сообщение для журнала; при повторной загрузке журнал не ведётся
+func (c *Consumer) messageRefs(msg kafka.Message) []db.MessageRef {
+	if c.skipLedger {
+		return nil
+	}
+	return []db.MessageRef{messageRef(msg)}
+}
+
+// Ссылка на сообщение для журнала обработанных сообщений
+func messageRef(msg kafka.Message) db.MessageRef {
+	ref := db.MessageRef{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, HeaderEventID) {
+			ref.EventID = string(h.Value)
+		}
+	}
+	return ref
+}
+
+var errNotRejected = errors.New("message was neither quarantined nor published to dead letter queue")
+
+// Сохранение необработанного сообщения в карантин и отправка в DLQ. Пока сообщение
+// не попало ни туда, ни туда, запись повторяется по rejectRetry. false — ctx отменён
+// раньше, исходное смещение не подтверждается, и сообщение будет прочитано снова
+func (c *Consumer) reject(ctx context.Context, msg kafka.Message, class ErrorClass, cause error, attempts int) bool {
+	c.metrics.Failed(msg.Topic, string(class))
+
+	_, err := c.rejectRetry.Do(ctx, func() error {
+		quarantined := c.quarantineMessage(ctx, msg, class, cause, attempts)
+
+		published := false
+		if c.dlq != nil {
+			if err := c.dlq.Publish(ctx, msg, class, cause, attempts); err != nil {
+				c.logger.Printf("Ошибка отправки сообщения offset=%v в DLQ: %v", msg.Offset, err)
+			} else {
+				published = true
+			}
+		}
+
+		if !quarantined && !published {
+			return errNotRejected
+		}
+		return nil
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Сообщение partition=%v offset=%v не сохранено ни в карантин, ни в DLQ (попытка %v), повтор через %v",
+			msg.Partition, msg.Offset, attempt, wait)
+	})
+	if err != nil {
+		return false
+	}
+	c.metrics.Processed(msg.Topic, metrics.ResultRejected)
+	return true
+}
+
+// Подтверждение обработанных сообщений
+func (c *Consumer) commitProcessed(ctx context.Context, msgs ...kafka.Message) {
+	if err := c.offsets.commit(ctx, c.currentReader(), msgs...); err != nil {
+		c.metrics.Failed(msgs[0].Topic, metrics.FailureCommit)
+		c.logger.Printf("Ошибка подтверждения сообщений: %v", err)
+	}
+	if len(msgs) > 0 {
+		c.metrics.ObserveUncommitted(msgs[0].Topic, c.offsets.uncommitted())
+	}
+}
+
+// Счётчики консьюмера
+type ConsumerStats struct {
+	Duplicates    int64 // пропущенные повторные доставки
+	StaleVersions int64 // пропущенные устаревшие версии заказов
+}
+
+func (c *Consumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Duplicates:    c.duplicates.Load(),
+		StaleVersions: c.staleVersions.Load(),
+	}
 }
 
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	return c.currentReader().Close()
+}
+
+// Время обработки пачки и возраст обработанных сообщений
+func observeHandled(m *metrics.ConsumerMetrics, started time.Time, msgs, done []kafka.Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	m.ObserveBatch(msgs[0].Topic, time.Since(started))
+	for _, msg := range done {
+		m.ObserveMessage(msg)
+	}
+}
+
+// Периодическая передача статистики kafka.Reader в метрики. Фейковые читатели
+// в тестах статистики не дают, тогда опрос не запускается
+func reportReaderStats(ctx context.Context, reader func() MessageReader, m *metrics.ConsumerMetrics) {
+	if _, ok := reader().(interface{ Stats() kafka.ReaderStats }); !ok || m == nil {
+		return
+	}
+
+	ticker := time.NewTicker(readerStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Reader мог быть пересоздан после сброса смещений
+			if statsReader, ok := reader().(interface{ Stats() kafka.ReaderStats }); ok {
+				m.ObserveReaderStats(statsReader.Stats())
+			}
+		}
+	}
+}
+
+// Периодическая передача в метрики того, сколько смещение каждой партиции стоит на
+// месте при неподтверждённых сообщениях. Застрявшая партиция сама событий не даёт,
+// поэтому значение обновляется по таймеру, а не при обработке
+func reportCommitStalls(ctx context.Context, topic string, offsets *offsetTracker, m *metrics.ConsumerMetrics) {
+	if m == nil {
+		return
+	}
+
+	ticker := time.NewTicker(commitStallInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for partition, stalled := range offsets.stalls(now) {
+				m.ObserveCommitStall(topic, partition, stalled)
+			}
+		}
+	}
 }
@@ -0,0 +1,707 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"l0/internal/cache"
+	"l0/internal/db"
+	"l0/internal/model"
+	"l0/internal/validation"
+	"log"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type MockMessageReader struct {
+	fetchFn   func(ctx context.Context) (kafka.Message, error)
+	committed []kafka.Message
+}
+
+func (m *MockMessageReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if m.fetchFn != nil {
+		return m.fetchFn(ctx)
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (m *MockMessageReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	m.committed = append(m.committed, msgs...)
+	return nil
+}
+
+func (m *MockMessageReader) Close() error {
+	return nil
+}
+
+type MockMessageWriter struct {
+	writeFn func(ctx context.Context, msgs ...kafka.Message) error
+	written []kafka.Message
+}
+
+func (m *MockMessageWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if m.writeFn != nil {
+		if err := m.writeFn(ctx, msgs...); err != nil {
+			return err
+		}
+	}
+	m.written = append(m.written, msgs...)
+	return nil
+}
+
+func (m *MockMessageWriter) Close() error {
+	return nil
+}
+
+type MockOrderStore struct {
+	saveOrderFn    func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error
+	saveOrdersFn   func(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error)
+	deleteOrderFn  func(ctx context.Context, orderUID string, version int64, refs ...db.MessageRef) error
+	getOrderByIDFn func(ctx context.Context, orderUID string) (*model.Order, error)
+	forgetFn       func(ctx context.Context, topic string, partition int, from, to int64) (int64, error)
+}
+
+func (m *MockOrderStore) SaveOrder(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+	if m.saveOrderFn != nil {
+		return m.saveOrderFn(ctx, ord, refs...)
+	}
+	return nil
+}
+
+func (m *MockOrderStore) SaveOrders(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error) {
+	if m.saveOrdersFn != nil {
+		return m.saveOrdersFn(ctx, orders, refs)
+	}
+	return make([]db.SaveStatus, len(orders)), nil
+}
+
+func (m *MockOrderStore) DeleteOrder(ctx context.Context, orderUID string, version int64, refs ...db.MessageRef) error {
+	if m.deleteOrderFn != nil {
+		return m.deleteOrderFn(ctx, orderUID, version, refs...)
+	}
+	return nil
+}
+
+func (m *MockOrderStore) GetOrderByID(ctx context.Context, orderUID string) (*model.Order, error) {
+	if m.getOrderByIDFn != nil {
+		return m.getOrderByIDFn(ctx, orderUID)
+	}
+	return nil, nil
+}
+
+func (m *MockOrderStore) GetAllOrders(ctx context.Context) (map[string]model.Order, error) {
+	return map[string]model.Order{}, nil
+}
+
+func (m *MockOrderStore) IterateOrders(ctx context.Context, filter db.OrderFilter, fn func(model.Order) error) error {
+	return nil
+}
+
+func (m *MockOrderStore) ForgetMessages(ctx context.Context, topic string, partition int, from, to int64) (int64, error) {
+	if m.forgetFn != nil {
+		return m.forgetFn(ctx, topic, partition, from, to)
+	}
+	return 0, nil
+}
+
+func newTestConsumer(store *MockOrderStore, writer *MockMessageWriter) (*Consumer, *MockMessageReader, *cache.Cache) {
+	logger := log.New(io.Discard, "", 0)
+	reader := &MockMessageReader{}
+	cached := cache.NewCache(10)
+	return &Consumer{
+		reader:       reader,
+		repo:         store,
+		cachedOrders: cached,
+		dlq:          NewDeadLetterQueueWithWriter(writer, "orders.dlq", logger),
+		decoder:      JSONDecoder{},
+		retry:        newTestRetryPolicy(),
+		rejectRetry:  rejectPolicy(newTestRetryPolicy()),
+		workers:      1,
+		drainTimeout: time.Second,
+		offsets:      newOffsetTracker(),
+		control:      newConsumerControl(),
+		logger:       logger,
+	}, reader, cached
+}
+
+func newTestValidator() *validation.Validator {
+	v, err := validation.New(validation.LocaleEN, nil)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func newTestMessage(t *testing.T, uid string) kafka.Message {
+	value, err := json.Marshal(model.Order{OrderUID: uid, DateCreated: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to marshal order: %v", err)
+	}
+	return kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte(uid), Value: value}
+}
+
+// Обработка сообщения так же, как это делает воркер после FetchMessage
+func handle(c *Consumer, msg kafka.Message) {
+	c.offsets.track(msg)
+	c.handleBatch(context.Background(), []kafka.Message{msg})
+}
+
+func headerValue(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// ТЕСТЫ
+
+func TestConsumer_ProcessMessage_Success(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(&MockOrderStore{}, writer)
+
+	handle(c, newTestMessage(t, "ok-1"))
+
+	if _, ok := cached.GetOrder("ok-1"); !ok {
+		t.Error("Order should be cached after successful processing")
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed message, got %d", len(reader.committed))
+	}
+	if len(writer.written) != 0 {
+		t.Errorf("Expected no DLQ messages, got %d", len(writer.written))
+	}
+}
+
+func TestConsumer_ProcessMessage_DecodeErrorGoesToDLQ(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, reader, _ := newTestConsumer(&MockOrderStore{}, writer)
+
+	msg := kafka.Message{Topic: "orders", Partition: 1, Offset: 7, Value: []byte("{not json")}
+	handle(c, msg)
+
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 DLQ message, got %d", len(writer.written))
+	}
+	dlqMsg := writer.written[0]
+	if string(dlqMsg.Value) != "{not json" {
+		t.Errorf("DLQ payload should be the original one, got %s", dlqMsg.Value)
+	}
+	if got := headerValue(dlqMsg, HeaderErrorClass); got != string(ErrorClassDecode) {
+		t.Errorf("Expected error class %q, got %q", ErrorClassDecode, got)
+	}
+	if got := headerValue(dlqMsg, HeaderSourcePartition); got != "1" {
+		t.Errorf("Expected source partition 1, got %q", got)
+	}
+	if got := headerValue(dlqMsg, HeaderSourceOffset); got != "7" {
+		t.Errorf("Expected source offset 7, got %q", got)
+	}
+	if got := headerValue(dlqMsg, HeaderAttempts); got != "1" {
+		t.Errorf("Expected attempts 1, got %q", got)
+	}
+	if headerValue(dlqMsg, HeaderErrorDetail) == "" {
+		t.Error("Expected non-empty error detail")
+	}
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 7 {
+		t.Errorf("Source offset should be committed, got %+v", reader.committed)
+	}
+}
+
+func TestConsumer_ProcessMessage_PersistErrorGoesToDLQ(t *testing.T) {
+	writer := &MockMessageWriter{}
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			return errors.New("constraint violation")
+		},
+	}
+	c, reader, cached := newTestConsumer(store, writer)
+
+	handle(c, newTestMessage(t, "bad-1"))
+
+	if _, ok := cached.GetOrder("bad-1"); ok {
+		t.Error("Failed order must not be cached")
+	}
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 DLQ message, got %d", len(writer.written))
+	}
+	if got := headerValue(writer.written[0], HeaderErrorClass); got != string(ErrorClassPersist) {
+		t.Errorf("Expected error class %q, got %q", ErrorClassPersist, got)
+	}
+	if string(writer.written[0].Key) != "bad-1" {
+		t.Errorf("DLQ message should keep the original key, got %s", writer.written[0].Key)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed message, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_ProcessMessage_RetriesTransientSaveErrors(t *testing.T) {
+	calls := 0
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("failed to begin transaction: %w", syscall.ECONNREFUSED)
+			}
+			return nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(store, writer)
+
+	handle(c, newTestMessage(t, "retry-1"))
+
+	if calls != 3 {
+		t.Errorf("Expected 3 save attempts, got %d", calls)
+	}
+	if _, ok := cached.GetOrder("retry-1"); !ok {
+		t.Error("Order should be cached after successful retry")
+	}
+	if len(writer.written) != 0 || len(reader.committed) != 1 {
+		t.Errorf("Expected commit without DLQ, got %d DLQ messages and %d commits", len(writer.written), len(reader.committed))
+	}
+}
+
+func TestConsumer_ProcessMessage_ExhaustedRetriesGoToDLQ(t *testing.T) {
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			return syscall.ECONNREFUSED
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, _, _ := newTestConsumer(store, writer)
+	c.retry.MaxElapsedTime = 10 * time.Millisecond
+
+	handle(c, newTestMessage(t, "retry-2"))
+
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 DLQ message, got %d", len(writer.written))
+	}
+	if got := headerValue(writer.written[0], HeaderAttempts); got == "1" || got == "" {
+		t.Errorf("Expected several attempts in header, got %q", got)
+	}
+}
+
+func TestConsumer_HandleBatch_SavesValidOrdersInOneCall(t *testing.T) {
+	var saved [][]model.Order
+	store := &MockOrderStore{
+		saveOrdersFn: func(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error) {
+			saved = append(saved, orders)
+			return []db.SaveStatus{db.StatusSaved, db.StatusSaved}, nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(store, writer)
+
+	msgs := []kafka.Message{
+		newTestMessage(t, "batch-1"),
+		{Topic: "orders", Partition: 2, Offset: 43, Value: []byte("broken")},
+		newTestMessage(t, "batch-2"),
+	}
+	msgs[0].Offset, msgs[2].Offset = 42, 44
+	for _, msg := range msgs {
+		c.offsets.track(msg)
+	}
+	c.handleBatch(context.Background(), msgs)
+
+	if len(saved) != 1 || len(saved[0]) != 2 {
+		t.Fatalf("Expected one SaveOrders call with 2 orders, got %v", saved)
+	}
+	if len(writer.written) != 1 {
+		t.Errorf("Expected broken message in DLQ, got %d DLQ messages", len(writer.written))
+	}
+	if _, ok := cached.GetOrder("batch-2"); !ok {
+		t.Error("Batch orders should be cached")
+	}
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 44 {
+		t.Errorf("Expected single commit up to offset 44, got %+v", reader.committed)
+	}
+}
+
+func TestConsumer_HandleBatch_FallsBackToSingleSaves(t *testing.T) {
+	store := &MockOrderStore{
+		saveOrdersFn: func(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error) {
+			return nil, errors.New("constraint violation")
+		},
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			if ord.OrderUID == "bad" {
+				return errors.New("constraint violation")
+			}
+			return nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(store, writer)
+
+	good, bad := newTestMessage(t, "good"), newTestMessage(t, "bad")
+	bad.Offset = 43
+	c.offsets.track(good)
+	c.offsets.track(bad)
+	c.handleBatch(context.Background(), []kafka.Message{good, bad})
+
+	if _, ok := cached.GetOrder("good"); !ok {
+		t.Error("Good order should be saved individually")
+	}
+	if len(writer.written) != 1 || string(writer.written[0].Key) != "bad" {
+		t.Errorf("Only bad order should go to DLQ, got %+v", writer.written)
+	}
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 43 {
+		t.Errorf("Expected commit up to offset 43, got %+v", reader.committed)
+	}
+}
+
+func TestConsumer_ProcessMessage_SkipsDuplicates(t *testing.T) {
+	var gotRef db.MessageRef
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			gotRef = refs[0]
+			return fmt.Errorf("failed to save: %w", db.ErrDuplicate)
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(store, writer)
+
+	msg := newTestMessage(t, "dup-1")
+	msg.Headers = []kafka.Header{{Key: HeaderEventID, Value: []byte("evt-1")}}
+	handle(c, msg)
+
+	if gotRef.EventID != "evt-1" || gotRef.Offset != msg.Offset {
+		t.Errorf("Unexpected message ref: %+v", gotRef)
+	}
+	if _, ok := cached.GetOrder("dup-1"); ok {
+		t.Error("Duplicate must not be cached")
+	}
+	if len(writer.written) != 0 || len(reader.committed) != 1 {
+		t.Errorf("Duplicate should be committed without DLQ, got %d DLQ messages and %d commits", len(writer.written), len(reader.committed))
+	}
+	if got := c.Stats().Duplicates; got != 1 {
+		t.Errorf("Expected 1 duplicate, got %d", got)
+	}
+}
+
+func TestConsumer_HandleBatch_SkipsDuplicates(t *testing.T) {
+	store := &MockOrderStore{
+		saveOrdersFn: func(ctx context.Context, orders []model.Order, refs []db.MessageRef) ([]db.SaveStatus, error) {
+			return []db.SaveStatus{db.StatusDuplicate, db.StatusSaved}, nil
+		},
+	}
+	c, _, cached := newTestConsumer(store, &MockMessageWriter{})
+
+	first, second := newTestMessage(t, "seen"), newTestMessage(t, "fresh")
+	second.Offset = 43
+	c.offsets.track(first)
+	c.offsets.track(second)
+	c.handleBatch(context.Background(), []kafka.Message{first, second})
+
+	if _, ok := cached.GetOrder("seen"); ok {
+		t.Error("Duplicate must not be cached")
+	}
+	if _, ok := cached.GetOrder("fresh"); !ok {
+		t.Error("Fresh order should be cached")
+	}
+	if got := c.Stats().Duplicates; got != 1 {
+		t.Errorf("Expected 1 duplicate, got %d", got)
+	}
+}
+
+func TestConsumer_ProcessMessage_StaleVersionIsNotCached(t *testing.T) {
+	var gotVersion int64
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			gotVersion = ord.Version
+			return db.ErrStale
+		},
+	}
+	c, reader, cached := newTestConsumer(store, &MockMessageWriter{})
+
+	msg := newTestMessage(t, "old-1")
+	msg.Headers = []kafka.Header{{Key: HeaderEventVersion, Value: []byte("5")}}
+	handle(c, msg)
+
+	if gotVersion != 5 {
+		t.Errorf("Expected version 5 from header, got %d", gotVersion)
+	}
+	if _, ok := cached.GetOrder("old-1"); ok {
+		t.Error("Stale order must not be cached")
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Stale message should be committed, got %d commits", len(reader.committed))
+	}
+	if got := c.Stats().StaleVersions; got != 1 {
+		t.Errorf("Expected 1 stale version, got %d", got)
+	}
+}
+
+func TestEventVersion_FallsBackToPayloadAndDateCreated(t *testing.T) {
+	created := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+
+	if got := eventVersion(kafka.Message{}, model.Order{Version: 3, DateCreated: created}); got != 3 {
+		t.Errorf("Expected payload version 3, got %d", got)
+	}
+	if got := eventVersion(kafka.Message{}, model.Order{DateCreated: created}); got != created.UnixMicro() {
+		t.Errorf("Expected date_created fallback, got %d", got)
+	}
+}
+
+func TestConsumer_ProcessMessage_TombstoneDeletesOrder(t *testing.T) {
+	var deleted string
+	var deletedVersion int64
+	store := &MockOrderStore{
+		deleteOrderFn: func(ctx context.Context, orderUID string, version int64, refs ...db.MessageRef) error {
+			deleted, deletedVersion = orderUID, version
+			return nil
+		},
+	}
+	c, reader, cached := newTestConsumer(store, &MockMessageWriter{})
+	cached.SetOrder(model.Order{OrderUID: "gone-1"})
+
+	handle(c, kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte("gone-1"),
+		Headers: []kafka.Header{{Key: HeaderEventVersion, Value: []byte("7")}}})
+
+	if deleted != "gone-1" || deletedVersion != 7 {
+		t.Errorf("Expected order gone-1 to be deleted with version 7, got %q with %v", deleted, deletedVersion)
+	}
+	if _, ok := cached.GetOrder("gone-1"); ok {
+		t.Error("Deleted order must be evicted from cache")
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Tombstone should be committed, got %d commits", len(reader.committed))
+	}
+}
+
+func TestConsumer_ProcessMessage_TombstoneWithoutKeyGoesToDLQ(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, _, _ := newTestConsumer(&MockOrderStore{}, writer)
+
+	handle(c, kafka.Message{Topic: "orders", Offset: 42})
+
+	if len(writer.written) != 1 {
+		t.Errorf("Expected tombstone without key in DLQ, got %d DLQ messages", len(writer.written))
+	}
+}
+
+func TestConsumer_HandleBatch_TombstoneSplitsBatch(t *testing.T) {
+	var calls []string
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			calls = append(calls, "save:"+ord.OrderUID)
+			return nil
+		},
+		deleteOrderFn: func(ctx context.Context, orderUID string, version int64, refs ...db.MessageRef) error {
+			calls = append(calls, "delete:"+orderUID)
+			return nil
+		},
+	}
+	c, reader, cached := newTestConsumer(store, &MockMessageWriter{})
+
+	before, after := newTestMessage(t, "x"), newTestMessage(t, "x")
+	before.Offset, after.Offset = 41, 43
+	tombstone := kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte("x")}
+	msgs := []kafka.Message{before, tombstone, after}
+	for _, msg := range msgs {
+		c.offsets.track(msg)
+	}
+	c.handleBatch(context.Background(), msgs)
+
+	want := []string{"save:x", "delete:x", "save:x"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("Expected calls %v, got %v", want, calls)
+	}
+	if _, ok := cached.GetOrder("x"); !ok {
+		t.Error("Order re-created after tombstone should be cached")
+	}
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 43 {
+		t.Errorf("Expected commit up to offset 43, got %+v", reader.committed)
+	}
+}
+
+func TestConsumer_ProcessMessage_RetriesDLQUntilPublished(t *testing.T) {
+	calls := 0
+	writer := &MockMessageWriter{
+		writeFn: func(ctx context.Context, msgs ...kafka.Message) error {
+			calls++
+			if calls < 3 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		},
+	}
+	c, reader, _ := newTestConsumer(&MockOrderStore{}, writer)
+	// Бюджет политики не ограничивает запись отклонённого сообщения
+	c.rejectRetry.MaxElapsedTime = 0
+	c.rejectRetry = rejectPolicy(c.rejectRetry)
+
+	handle(c, kafka.Message{Value: []byte("garbage")})
+
+	if calls != 3 {
+		t.Errorf("Expected 3 DLQ publish attempts, got %v", calls)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed once DLQ publish succeeds, got %d commits", len(reader.committed))
+	}
+}
+
+func TestConsumer_ProcessMessage_DLQFailureDoesNotCommit(t *testing.T) {
+	writer := &MockMessageWriter{
+		writeFn: func(ctx context.Context, msgs ...kafka.Message) error {
+			return errors.New("broker unavailable")
+		},
+	}
+	c, reader, _ := newTestConsumer(&MockOrderStore{}, writer)
+
+	// Запись повторяется, пока не отменится контекст
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg := kafka.Message{Value: []byte("garbage")}
+	c.offsets.track(msg)
+	c.handleBatch(ctx, []kafka.Message{msg})
+
+	if len(reader.committed) != 0 {
+		t.Errorf("Offset must not be committed when DLQ publish fails, got %d commits", len(reader.committed))
+	}
+}
+
+func TestNewConsumer_RequiresDLQOrQuarantine(t *testing.T) {
+	_, err := NewConsumer(DefaultConfig(), &MockOrderStore{}, cache.NewCache(1), nil, nil, nil, newTestValidator(), nil, log.New(io.Discard, "", 0))
+	if err == nil {
+		t.Error("Expected error when neither DLQ nor quarantine is configured")
+	}
+}
+
+// Reader отдаёт одно сообщение и дальше ждёт отмены контекста
+func newSingleMessageReader(msg kafka.Message) *MockMessageReader {
+	var sent atomic.Bool
+	return &MockMessageReader{
+		fetchFn: func(ctx context.Context) (kafka.Message, error) {
+			if sent.CompareAndSwap(false, true) {
+				return msg, nil
+			}
+			<-ctx.Done()
+			return kafka.Message{}, ctx.Err()
+		},
+	}
+}
+
+func TestConsumer_StartDrainsInFlightOrders(t *testing.T) {
+	saving := make(chan struct{})
+	release := make(chan struct{})
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			close(saving)
+			<-release
+			return ctx.Err()
+		},
+	}
+	c, _, cached := newTestConsumer(store, &MockMessageWriter{})
+	reader := newSingleMessageReader(newTestMessage(t, "order-1"))
+	c.reader = reader
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan DrainStatus, 1)
+	go func() { done <- c.Start(ctx) }()
+
+	<-saving
+	cancel()
+	// Сохранение продолжается после отмены чтения
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+	status := <-done
+	if !status.Drained || status.Uncommitted != 0 {
+		t.Errorf("Expected drained consumer without uncommitted messages, got %+v", status)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("In-flight order should be committed before Start returns, got %+v", reader.committed)
+	}
+	if _, ok := cached.GetOrder("order-1"); !ok {
+		t.Error("In-flight order should be cached")
+	}
+}
+
+func TestConsumer_StartDrainTimeout(t *testing.T) {
+	saving := make(chan struct{})
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			close(saving)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	c, _, _ := newTestConsumer(store, &MockMessageWriter{})
+	c.drainTimeout = 50 * time.Millisecond
+	reader := newSingleMessageReader(newTestMessage(t, "order-1"))
+	c.reader = reader
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan DrainStatus, 1)
+	go func() { done <- c.Start(ctx) }()
+
+	<-saving
+	cancel()
+
+	select {
+	case status := <-done:
+		if status.Drained || status.Uncommitted != 1 {
+			t.Errorf("Expected interrupted drain with one uncommitted message, got %+v", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Start should return after drain timeout")
+	}
+	if len(reader.committed) != 0 {
+		t.Errorf("Interrupted order must not be committed, got %+v", reader.committed)
+	}
+}
+
+func TestConsumer_StartStopsFetchingAtUncommittedLimit(t *testing.T) {
+	release := make(chan struct{})
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			// Первое сообщение застревает и держит смещение партиции
+			if ord.OrderUID == "order-0" {
+				<-release
+			}
+			return nil
+		},
+	}
+	c, _, _ := newTestConsumer(store, &MockMessageWriter{})
+	c.workers = 2
+	c.maxPending = 3
+
+	var fetched atomic.Int64
+	c.reader = &MockMessageReader{
+		fetchFn: func(ctx context.Context) (kafka.Message, error) {
+			n := fetched.Add(1) - 1
+			msg := newTestMessage(t, fmt.Sprintf("order-%d", n))
+			msg.Partition, msg.Offset = 0, n
+			return msg, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan DrainStatus, 1)
+	go func() { done <- c.Start(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := fetched.Load(); got != 3 {
+		t.Errorf("Expected fetching to stop at 3 uncommitted messages, got %v fetched", got)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for fetched.Load() <= 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := fetched.Load(); got <= 3 {
+		t.Errorf("Fetching should resume after the stuck message is committed, got %v fetched", got)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"l0/internal/model"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовок с форматом тела сообщения
+const HeaderContentType = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeAvro     = "application/avro"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Decoder — превращение сообщения Kafka в заказ
+type Decoder interface {
+	Decode(ctx context.Context, msg kafka.Message) (model.Order, error)
+}
+
+// Обычный JSON без префикса схемы
+type JSONDecoder struct{}
+
+func (JSONDecoder) Decode(ctx context.Context, msg kafka.Message) (model.Order, error) {
+	var order model.Order
+	err := json.Unmarshal(msg.Value, &order)
+	return order, err
+}
+
+// Confluent wire format: нулевой magic byte и 4 байта ID схемы (big endian) перед телом
+const (
+	wireMagicByte  = 0
+	wireHeaderSize = 5
+)
+
+func isWireFormat(payload []byte) bool {
+	return len(payload) >= wireHeaderSize && payload[0] == wireMagicByte
+}
+
+func parseWireFormat(payload []byte) (int, []byte, error) {
+	if !isWireFormat(payload) {
+		return 0, nil, errors.New("payload is not in schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(payload[1:wireHeaderSize])), payload[wireHeaderSize:], nil
+}
+
+// Выбор декодера по заголовку content-type, а без него — по префиксу сообщения:
+// для wire format тип схемы берётся из registry, всё остальное считается JSON
+type MultiDecoder struct {
+	registry SchemaRegistry
+	json     Decoder
+	avro     Decoder
+	protobuf Decoder
+}
+
+// registry может быть nil — тогда поддерживается только JSON
+func NewMultiDecoder(registry SchemaRegistry) *MultiDecoder {
+	d := &MultiDecoder{
+		registry: registry,
+		json:     JSONDecoder{},
+	}
+	if registry != nil {
+		d.avro = NewAvroDecoder(registry)
+		d.protobuf = NewProtobufDecoder(registry)
+	}
+	return d
+}
+
+func (d *MultiDecoder) Decode(ctx context.Context, msg kafka.Message) (model.Order, error) {
+	contentType := contentTypeOf(msg)
+
+	switch contentType {
+	case ContentTypeJSON:
+		return d.json.Decode(ctx, msg)
+	case ContentTypeAvro:
+		return d.decodeWith(ctx, d.avro, msg)
+	case ContentTypeProtobuf:
+		return d.decodeWith(ctx, d.protobuf, msg)
+	case "":
+	default:
+		return model.Order{}, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	if !isWireFormat(msg.Value) {
+		return d.json.Decode(ctx, msg)
+	}
+	if d.registry == nil {
+		return model.Order{}, errors.New("message has schema id prefix but schema registry is not configured")
+	}
+
+	schemaID, body, _ := parseWireFormat(msg.Value)
+	schema, err := d.registry.GetSchema(ctx, schemaID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	switch schema.Type {
+	case SchemaTypeAvro:
+		return d.avro.Decode(ctx, msg)
+	case SchemaTypeProtobuf:
+		return d.protobuf.Decode(ctx, msg)
+	case SchemaTypeJSON:
+		msg.Value = body
+		return d.json.Decode(ctx, msg)
+	default:
+		return model.Order{}, fmt.Errorf("unsupported schema type %q for schema %v", schema.Type, schemaID)
+	}
+}
+
+func (d *MultiDecoder) decodeWith(ctx context.Context, decoder Decoder, msg kafka.Message) (model.Order, error) {
+	if decoder == nil {
+		return model.Order{}, errors.New("schema registry is not configured")
+	}
+	return decoder.Decode(ctx, msg)
+}
+
+func contentTypeOf(msg kafka.Message) string {
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, HeaderContentType) {
+			value, _, _ := strings.Cut(string(h.Value), ";")
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// Промежуточное представление (map/slice/скаляры) переводится в заказ через JSON,
+// чтобы двоичные форматы опирались на те же json-теги модели, что и основной формат
+func orderFromNative(native interface{}) (model.Order, error) {
+	var order model.Order
+	data, err := json.Marshal(native)
+	if err != nil {
+		return order, fmt.Errorf("failed to convert decoded message: %w", err)
+	}
+	if err := json.Unmarshal(data, &order); err != nil {
+		return order, fmt.Errorf("failed to convert decoded message: %w", err)
+	}
+	return order, nil
+}
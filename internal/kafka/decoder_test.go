@@ -0,0 +1,348 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const testAvroSchema = `{
+  "type": "record",
+  "name": "Order",
+  "fields": [
+    {"name": "order_uid", "type": "string"},
+    {"name": "track_number", "type": ["null", "string"], "default": null},
+    {"name": "date_created", "type": "string"},
+    {"name": "payment", "type": {
+      "type": "record",
+      "name": "Payment",
+      "fields": [
+        {"name": "amount", "type": "double"},
+        {"name": "payment_dt", "type": "long"}
+      ]
+    }}
+  ]
+}`
+
+const testProtoSchema = `
+syntax = "proto3";
+package orders;
+
+import "google/protobuf/timestamp.proto";
+
+message Ping {}
+
+message Order {
+  string order_uid = 1;
+  string track_number = 2;
+  google.protobuf.Timestamp date_created = 3;
+  Payment payment = 4;
+  repeated Item items = 5;
+}
+
+message Payment {
+  double amount = 1;
+  int64 payment_dt = 2;
+}
+
+message Item {
+  int32 chrt_id = 1;
+}
+`
+
+func wirePrefix(schemaID int) []byte {
+	prefix := make([]byte, wireHeaderSize)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(schemaID))
+	return prefix
+}
+
+func TestMultiDecoder_PlainJSON(t *testing.T) {
+	decoder := NewMultiDecoder(nil)
+
+	order, err := decoder.Decode(context.Background(), kafka.Message{Value: []byte(`{"order_uid":"json-1"}`)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if order.OrderUID != "json-1" {
+		t.Errorf("Expected order json-1, got %q", order.OrderUID)
+	}
+}
+
+func TestMultiDecoder_WireFormatWithoutRegistry(t *testing.T) {
+	decoder := NewMultiDecoder(nil)
+
+	_, err := decoder.Decode(context.Background(), kafka.Message{Value: append(wirePrefix(1), 0x02)})
+	if err == nil {
+		t.Error("Expected error for wire format message without registry")
+	}
+}
+
+func TestMultiDecoder_UnknownContentType(t *testing.T) {
+	decoder := NewMultiDecoder(NewMemorySchemaRegistry())
+	msg := kafka.Message{
+		Value:   []byte(`{}`),
+		Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte("text/xml")}},
+	}
+
+	if _, err := decoder.Decode(context.Background(), msg); err == nil {
+		t.Error("Expected error for unsupported content type")
+	}
+}
+
+func TestMultiDecoder_Avro(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	registry.Register(7, SchemaTypeAvro, testAvroSchema)
+
+	codec, err := goavro.NewCodecForStandardJSONFull(testAvroSchema)
+	if err != nil {
+		t.Fatalf("Failed to build codec: %v", err)
+	}
+	native, _, err := codec.NativeFromTextual([]byte(`{
+		"order_uid": "avro-1",
+		"track_number": "WBTRACK",
+		"date_created": "2021-11-26T06:22:19Z",
+		"payment": {"amount": 1817, "payment_dt": 1637907727}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to build native value: %v", err)
+	}
+	body, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		t.Fatalf("Failed to encode avro: %v", err)
+	}
+
+	order, err := NewMultiDecoder(registry).Decode(context.Background(), kafka.Message{Value: append(wirePrefix(7), body...)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if order.OrderUID != "avro-1" || order.TrackNumber != "WBTRACK" {
+		t.Errorf("Unexpected order: %+v", order)
+	}
+	if order.Payment.PaymentDT != 1637907727 || order.Payment.Amount != 1817 {
+		t.Errorf("Unexpected payment: %+v", order.Payment)
+	}
+	if order.DateCreated.IsZero() {
+		t.Error("Expected date_created to be decoded")
+	}
+}
+
+func TestMultiDecoder_ProtobufSelectedByHeader(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	registry.Register(9, SchemaTypeProtobuf, testProtoSchema)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": testProtoSchema}),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), "test.proto")
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+	orderDesc := files[0].Messages().ByName("Order")
+
+	msg := dynamicpb.NewMessage(orderDesc)
+	msg.Set(orderDesc.Fields().ByName("order_uid"), protoreflect.ValueOfString("proto-1"))
+
+	ts := msg.Mutable(orderDesc.Fields().ByName("date_created")).Message()
+	ts.Set(ts.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(1637907739))
+
+	payment := msg.Mutable(orderDesc.Fields().ByName("payment")).Message()
+	payment.Set(payment.Descriptor().Fields().ByName("payment_dt"), protoreflect.ValueOfInt64(1637907727))
+
+	items := msg.Mutable(orderDesc.Fields().ByName("items")).List()
+	item := items.NewElement()
+	item.Message().Set(item.Message().Descriptor().Fields().ByName("chrt_id"), protoreflect.ValueOfInt32(9934930))
+	items.Append(item)
+
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to encode protobuf: %v", err)
+	}
+
+	// Order — второе сообщение файла: одна позиция индекса со значением 1 (zigzag: 2, 2)
+	value := append(wirePrefix(9), 0x02, 0x02)
+	value = append(value, body...)
+
+	order, err := NewMultiDecoder(registry).Decode(context.Background(), kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: "Content-Type", Value: []byte("application/x-protobuf")}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if order.OrderUID != "proto-1" {
+		t.Errorf("Expected order proto-1, got %q", order.OrderUID)
+	}
+	if order.DateCreated.Unix() != 1637907739 {
+		t.Errorf("Unexpected date_created: %v", order.DateCreated)
+	}
+	if order.Payment.PaymentDT != 1637907727 {
+		t.Errorf("Unexpected payment_dt: %v", order.Payment.PaymentDT)
+	}
+	if len(order.Items) != 1 || order.Items[0].ChrtID != 9934930 {
+		t.Errorf("Unexpected items: %+v", order.Items)
+	}
+}
+
+func TestRegistryClient_FetchesAndCachesSchema(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/schemas/ids/3" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"schema": "{\"type\":\"string\"}"}`))
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(server.URL+"/", "", "")
+	for i := 0; i < 2; i++ {
+		schema, err := client.GetSchema(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if schema.Type != SchemaTypeAvro {
+			t.Errorf("Schema without schemaType should be Avro, got %v", schema.Type)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected schema to be fetched once, got %d requests", requests)
+	}
+
+	if _, err := client.GetSchema(context.Background(), 4); err == nil {
+		t.Error("Expected error for missing schema")
+	}
+}
+
+func TestRegistryClient_UnavailableIsTransient(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	client := NewRegistryClient(server.URL, "", "")
+
+	_, err := client.GetSchema(context.Background(), 1)
+	if !errors.Is(err, ErrRegistryUnavailable) || !IsTransient(err) {
+		t.Errorf("5xx from registry must be transient, got %v", err)
+	}
+
+	status = http.StatusNotFound
+	_, err = client.GetSchema(context.Background(), 1)
+	if err == nil || IsTransient(err) {
+		t.Errorf("Missing schema must be a permanent error, got %v", err)
+	}
+
+	server.Close()
+	_, err = client.GetSchema(context.Background(), 1)
+	if !errors.Is(err, ErrRegistryUnavailable) {
+		t.Errorf("Connection failure must be transient, got %v", err)
+	}
+}
+
+// Registry, отвечающий ошибкой первые failures раз
+type flakyRegistry struct {
+	failures int
+	calls    int
+	schema   Schema
+}
+
+func (r *flakyRegistry) GetSchema(ctx context.Context, id int) (Schema, error) {
+	r.calls++
+	if r.calls <= r.failures {
+		return Schema{}, fmt.Errorf("failed to fetch schema %v: %w: registry returned 503", id, ErrRegistryUnavailable)
+	}
+	return r.schema, nil
+}
+
+func TestConsumer_RetriesRegistryFailures(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestConsumer(&MockOrderStore{}, writer)
+	registry := &flakyRegistry{failures: 2, schema: Schema{ID: 7, Type: SchemaTypeJSON}}
+	c.decoder = NewMultiDecoder(registry)
+
+	msg := newTestMessage(t, "registry-1")
+	msg.Value = append(wirePrefix(7), msg.Value...)
+	handle(c, msg)
+
+	if registry.calls != 3 {
+		t.Errorf("Expected 3 registry calls, got %v", registry.calls)
+	}
+	if len(writer.written) != 0 {
+		t.Errorf("Registry outage must not send the message to DLQ, got %d", len(writer.written))
+	}
+	if _, ok := cached.GetOrder("registry-1"); !ok || len(reader.committed) != 1 {
+		t.Error("Order must be saved and committed once the registry recovers")
+	}
+}
+
+// Registry, который отдаёт схемы через fn
+type MockSchemaRegistry struct {
+	getSchemaFn func(ctx context.Context, id int) (Schema, error)
+}
+
+func (m *MockSchemaRegistry) GetSchema(ctx context.Context, id int) (Schema, error) {
+	return m.getSchemaFn(ctx, id)
+}
+
+func TestSchemaCache_DoesNotBlockOnRegistryFetch(t *testing.T) {
+	var fetches atomic.Int32
+	slow := make(chan struct{})
+	registry := &MockSchemaRegistry{getSchemaFn: func(ctx context.Context, id int) (Schema, error) {
+		fetches.Add(1)
+		if id == 2 {
+			<-slow
+		}
+		return Schema{ID: id, Type: SchemaTypeAvro, Definition: testAvroSchema}, nil
+	}}
+	decoder := NewAvroDecoder(registry)
+	if _, err := decoder.codec(context.Background(), 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Два запроса схемы 2 ждут registry, схема 1 из кэша при этом доступна
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := decoder.codec(context.Background(), 2)
+			results <- err
+		}()
+	}
+	cached := make(chan error, 1)
+	go func() {
+		_, err := decoder.codec(context.Background(), 1)
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cached schema must not wait for another schema's registry fetch")
+	}
+
+	close(slow)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("Expected one fetch per schema, got %v fetches", n)
+	}
+}
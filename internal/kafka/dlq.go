@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, которые добавляются к сообщению при отправке в DLQ
+const (
+	HeaderErrorClass      = "x-dlq-error-class"
+	HeaderErrorDetail     = "x-dlq-error-detail"
+	HeaderSourceTopic     = "x-dlq-source-topic"
+	HeaderSourcePartition = "x-dlq-source-partition"
+	HeaderSourceOffset    = "x-dlq-source-offset"
+	HeaderAttempts        = "x-dlq-attempts"
+)
+
+// Класс ошибки, из-за которой сообщение не удалось обработать
+type ErrorClass string
+
+const (
+	ErrorClassDecode   ErrorClass = "decode"
+	ErrorClassValidate ErrorClass = "validate"
+	ErrorClassPersist  ErrorClass = "persist"
+)
+
+// MessageWriter — то, что нужно DLQ от продюсера. Позволяет подменить брокер в тестах
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type DeadLetterQueue struct {
+	writer MessageWriter
+	topic  string
+	logger *log.Logger
+}
+
+func NewDeadLetterQueue(brokers []string, topic string, security SecurityConfig, logger *log.Logger) (*DeadLetterQueue, error) {
+	transport, err := security.transport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure dlq transport: %w", err)
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}
+
+	return NewDeadLetterQueueWithWriter(writer, topic, logger), nil
+}
+
+// Создание DLQ поверх произвольного писателя (например, фейкового в тестах)
+func NewDeadLetterQueueWithWriter(writer MessageWriter, topic string, logger *log.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		writer: writer,
+		topic:  topic,
+		logger: logger,
+	}
+}
+
+// Публикация исходного сообщения в DLQ вместе с информацией об ошибке
+func (d *DeadLetterQueue) Publish(ctx context.Context, msg kafka.Message, class ErrorClass, cause error, attempts int) error {
+	detail := ""
+	if cause != nil {
+		detail = cause.Error()
+	}
+
+	headers := make([]kafka.Header, 0, len(msg.Headers)+6)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderErrorClass, Value: []byte(class)},
+		kafka.Header{Key: HeaderErrorDetail, Value: []byte(detail)},
+		kafka.Header{Key: HeaderSourceTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	dlqMsg := kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+
+	if err := d.writer.WriteMessages(ctx, dlqMsg); err != nil {
+		return fmt.Errorf("failed to publish message to dlq topic %v: %w", d.topic, err)
+	}
+
+	d.logger.Printf("Сообщение partition=%v offset=%v отправлено в %v (%v): %v",
+		msg.Partition, msg.Offset, d.topic, class, detail)
+	return nil
+}
+
+func (d *DeadLetterQueue) Close() error {
+	return d.writer.Close()
+}
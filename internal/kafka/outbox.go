@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"l0/internal/db"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовок с типом события outbox
+const HeaderEventType = "event-type"
+
+// Настройки публикации событий из outbox
+type OutboxConfig struct {
+	Topic        string // пустой — relay не запускается
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+func DefaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		PollInterval: time.Second,
+		BatchSize:    100,
+	}
+}
+
+// Relay переносит события из таблицы outbox в Kafka. Доставка at-least-once:
+// запись помечается отправленной только после подтверждения брокера, и если
+// отметка не сохранилась, событие уйдёт ещё раз с тем же event-id
+type OutboxRelay struct {
+	store     db.OutboxStore
+	writer    MessageWriter
+	topic     string
+	interval  time.Duration
+	batchSize int
+	logger    *log.Logger
+}
+
+func NewOutboxRelay(brokers []string, cfg OutboxConfig, security SecurityConfig, store db.OutboxStore, logger *log.Logger) (*OutboxRelay, error) {
+	transport, err := security.transport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure outbox transport: %w", err)
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}
+
+	return NewOutboxRelayWithWriter(writer, cfg, store, logger), nil
+}
+
+// Создание relay поверх произвольного писателя (например, фейкового в тестах)
+func NewOutboxRelayWithWriter(writer MessageWriter, cfg OutboxConfig, store db.OutboxStore, logger *log.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		store:     store,
+		writer:    writer,
+		topic:     cfg.Topic,
+		interval:  cfg.PollInterval,
+		batchSize: cfg.BatchSize,
+		logger:    logger,
+	}
+}
+
+// Опрос outbox до отмены контекста. Пока выбираются полные пачки, следующая
+// берётся сразу, без ожидания интервала
+func (r *OutboxRelay) Run(ctx context.Context) {
+	r.logger.Printf("Запуск публикации событий в %v...", r.topic)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Printf("Ошибка публикации событий outbox: %v", err)
+		}
+		if err == nil && sent == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Println("Остановка публикации событий...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Публикация одной пачки. Возвращает число отправленных событий
+func (r *OutboxRelay) relay(ctx context.Context) (int, error) {
+	return r.store.ProcessOutbox(ctx, r.batchSize, func(msgs []db.OutboxMessage) error {
+		kafkaMsgs := make([]kafka.Message, len(msgs))
+		for i, msg := range msgs {
+			kafkaMsgs[i] = outboxMessage(msg)
+		}
+		if err := r.writer.WriteMessages(ctx, kafkaMsgs...); err != nil {
+			return fmt.Errorf("failed to publish outbox messages to %v: %w", r.topic, err)
+		}
+		r.logger.Printf("Опубликовано %v событий в %v", len(msgs), r.topic)
+		return nil
+	})
+}
+
+// ID записи outbox служит event-id, чтобы получатели отбрасывали повторы
+func outboxMessage(msg db.OutboxMessage) kafka.Message {
+	return kafka.Message{
+		Key:   []byte(msg.Key),
+		Value: msg.Payload,
+		Headers: []kafka.Header{
+			{Key: HeaderEventID, Value: []byte("outbox-" + strconv.FormatInt(msg.ID, 10))},
+			{Key: HeaderEventType, Value: []byte(msg.EventType)},
+			{Key: HeaderContentType, Value: []byte(ContentTypeJSON)},
+		},
+		Time: msg.CreatedAt,
+	}
+}
+
+func (r *OutboxRelay) Close() error {
+	return r.writer.Close()
+}
@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"l0/internal/db"
+	"log"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Outbox в памяти: ProcessOutbox ведёт себя как транзакция — при ошибке publish
+// записи остаются неотправленными
+type MockOutboxStore struct {
+	pending []db.OutboxMessage
+	sent    []db.OutboxMessage
+}
+
+func (m *MockOutboxStore) ProcessOutbox(ctx context.Context, limit int, publish func([]db.OutboxMessage) error) (int, error) {
+	n := min(limit, len(m.pending))
+	if n == 0 {
+		return 0, nil
+	}
+	batch := m.pending[:n]
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	m.sent = append(m.sent, batch...)
+	m.pending = m.pending[n:]
+	return n, nil
+}
+
+func newTestRelay(store *MockOutboxStore, writer *MockMessageWriter) *OutboxRelay {
+	cfg := DefaultOutboxConfig()
+	cfg.BatchSize = 2
+	return NewOutboxRelayWithWriter(writer, cfg, store, log.New(io.Discard, "", 0))
+}
+
+func TestOutboxRelay_PublishesAndMarksSent(t *testing.T) {
+	store := &MockOutboxStore{pending: []db.OutboxMessage{
+		{ID: 1, EventType: db.EventOrderAccepted, Key: "order-1", Payload: []byte(`{"order_uid":"order-1"}`)},
+		{ID: 2, EventType: db.EventOrderAccepted, Key: "order-2", Payload: []byte(`{"order_uid":"order-2"}`)},
+		{ID: 3, EventType: db.EventOrderAccepted, Key: "order-3", Payload: []byte(`{"order_uid":"order-3"}`)},
+	}}
+	writer := &MockMessageWriter{}
+	relay := newTestRelay(store, writer)
+
+	for {
+		sent, err := relay.relay(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if sent == 0 {
+			break
+		}
+	}
+
+	if len(store.sent) != 3 || len(store.pending) != 0 {
+		t.Fatalf("Expected all 3 events to be marked sent, got sent=%v pending=%v", len(store.sent), len(store.pending))
+	}
+	if len(writer.written) != 3 {
+		t.Fatalf("Expected 3 published messages, got %v", len(writer.written))
+	}
+
+	msg := writer.written[0]
+	if string(msg.Key) != "order-1" {
+		t.Errorf("Expected key order-1, got %s", msg.Key)
+	}
+	if id := headerValue(msg, HeaderEventID); id != "outbox-1" {
+		t.Errorf("Expected event id outbox-1, got %v", id)
+	}
+	if eventType := headerValue(msg, HeaderEventType); eventType != db.EventOrderAccepted {
+		t.Errorf("Expected event type %v, got %v", db.EventOrderAccepted, eventType)
+	}
+}
+
+func TestOutboxRelay_FailedPublishKeepsEventsPending(t *testing.T) {
+	store := &MockOutboxStore{pending: []db.OutboxMessage{
+		{ID: 1, EventType: db.EventOrderAccepted, Key: "order-1", Payload: []byte(`{}`)},
+	}}
+	writer := &MockMessageWriter{
+		writeFn: func(ctx context.Context, msgs ...kafka.Message) error {
+			return errors.New("broker unavailable")
+		},
+	}
+	relay := newTestRelay(store, writer)
+
+	if _, err := relay.relay(context.Background()); err == nil {
+		t.Fatal("Expected publish error")
+	}
+	if len(store.pending) != 1 || len(store.sent) != 0 {
+		t.Errorf("Event must stay pending after failed publish, got sent=%v pending=%v", len(store.sent), len(store.pending))
+	}
+
+	// Брокер восстановился — событие уходит при следующем опросе
+	writer.writeFn = nil
+	if sent, err := relay.relay(context.Background()); err != nil || sent != 1 {
+		t.Errorf("Expected event to be published on retry, got sent=%v err=%v", sent, err)
+	}
+}
@@ -0,0 +1,318 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Пул воркеров. Сообщения распределяются по хэшу order_uid, поэтому
+// обновления одного заказа всегда обрабатываются одним воркером по порядку.
+// Каждый воркер копит пачку до batchSize сообщений или batchWait с первого из них
+type workerPool struct {
+	queues    []chan kafka.Message
+	batchSize int
+	batchWait time.Duration
+	wg        sync.WaitGroup
+}
+
+func newWorkerPool(size, batchSize int, batchWait time.Duration, handle func(msgs []kafka.Message)) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	p := &workerPool{
+		queues:    make([]chan kafka.Message, size),
+		batchSize: batchSize,
+		batchWait: batchWait,
+	}
+	for i := range p.queues {
+		queue := make(chan kafka.Message, 16)
+		p.queues[i] = queue
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(queue, handle)
+		}()
+	}
+	return p
+}
+
+func (p *workerPool) run(queue <-chan kafka.Message, handle func(msgs []kafka.Message)) {
+	batch := make([]kafka.Message, 0, p.batchSize)
+	var timer *time.Timer
+	var deadline <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
+		}
+		if len(batch) > 0 {
+			handle(batch)
+			batch = make([]kafka.Message, 0, p.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= p.batchSize {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(p.batchWait)
+				deadline = timer.C
+			}
+		case <-deadline:
+			flush()
+		}
+	}
+}
+
+// Отправка сообщения воркеру. Блокируется, если очередь воркера заполнена
+func (p *workerPool) dispatch(ctx context.Context, msg kafka.Message) bool {
+	h := fnv.New32a()
+	h.Write([]byte(orderingKey(msg)))
+	queue := p.queues[h.Sum32()%uint32(len(p.queues))]
+
+	select {
+	case queue <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Закрытие очередей и ожидание, пока воркеры доработают то, что уже получили
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// Остановка пула при завершении работы: воркеры дообрабатывают полученные сообщения,
+// а по истечении timeout cancel отменяет их контекст, и незавершённые сохранения
+// прерываются. Возвращает false, если пришлось прерывать
+func (p *workerPool) drain(timeout time.Duration, cancel context.CancelFunc) bool {
+	stopped := make(chan struct{})
+	go func() {
+		p.stop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+		return true
+	case <-timer.C:
+		cancel()
+		<-stopped
+		return false
+	}
+}
+
+// Ключ упорядочивания: ключ сообщения, иначе order_uid из тела,
+// а если его не достать — номер партиции
+func orderingKey(msg kafka.Message) string {
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+
+	var probe struct {
+		OrderUID string `json:"order_uid"`
+	}
+	if err := json.Unmarshal(msg.Value, &probe); err == nil && probe.OrderUID != "" {
+		return probe.OrderUID
+	}
+	return "partition-" + strconv.Itoa(msg.Partition)
+}
+
+// Учёт обработанных смещений. Коммитится только наибольшее смещение,
+// до которого все сообщения партиции уже обработаны
+type offsetTracker struct {
+	mu         sync.Mutex
+	commitMu   sync.Mutex
+	partitions map[int]*partitionOffsets
+	released   chan struct{} // закрывается, когда смещение какой-либо партиции сдвинулось
+}
+
+type partitionOffsets struct {
+	pending   []kafka.Message // полученные, но ещё не закоммиченные сообщения в порядке смещений
+	done      map[int64]bool
+	committed int64
+	since     time.Time // с какого момента смещение ждёт pending[0]
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+		released:   make(chan struct{}),
+	}
+}
+
+func (t *offsetTracker) track(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool), committed: -1}
+		t.partitions[msg.Partition] = p
+	}
+	if len(p.pending) == 0 {
+		p.since = time.Now()
+	}
+	p.pending = append(p.pending, msg)
+}
+
+// Забыть все полученные сообщения (после сброса смещений группы они будут прочитаны
+// заново). Ждущие в waitBelow проверяют предел ещё раз
+func (t *offsetTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partitions = make(map[int]*partitionOffsets)
+	close(t.released)
+	t.released = make(chan struct{})
+}
+
+// Сколько смещение каждой партиции не сдвигается, хотя есть неподтверждённые
+// сообщения. У партиций без таких сообщений — 0
+func (t *offsetTracker) stalls(now time.Time) map[int]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stalls := make(map[int]time.Duration, len(t.partitions))
+	for partition, p := range t.partitions {
+		if len(p.pending) > 0 {
+			stalls[partition] = now.Sub(p.since)
+		} else {
+			stalls[partition] = 0
+		}
+	}
+	return stalls
+}
+
+// Число полученных сообщений, смещения которых ещё не закоммичены
+func (t *offsetTracker) uncommitted() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.uncommittedLocked()
+}
+
+func (t *offsetTracker) uncommittedLocked() int {
+	n := 0
+	for _, p := range t.partitions {
+		n += len(p.pending)
+	}
+	return n
+}
+
+// Ожидание, пока неподтверждённых сообщений станет меньше limit. Пока самое раннее
+// сообщение партиции не обработано, её смещение не сдвигается, и без ограничения
+// pending и done росли бы без конца. onWait вызывается один раз, если ждать
+// пришлось. limit <= 0 — без ограничения. false — ctx отменён
+func (t *offsetTracker) waitBelow(ctx context.Context, limit int, onWait func(uncommitted int)) bool {
+	if limit <= 0 {
+		return true
+	}
+	waited := false
+	for {
+		t.mu.Lock()
+		n := t.uncommittedLocked()
+		released := t.released
+		t.mu.Unlock()
+
+		if n < limit {
+			return true
+		}
+		if !waited && onWait != nil {
+			onWait(n)
+		}
+		waited = true
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-released:
+		}
+	}
+}
+
+// Отмечает сообщение обработанным и возвращает сообщение, смещение которого
+// теперь можно закоммитить. false — коммитить пока нечего
+func (t *offsetTracker) markDone(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[msg.Offset] = true
+
+	var last kafka.Message
+	advanced := false
+	for len(p.pending) > 0 && p.done[p.pending[0].Offset] {
+		last = p.pending[0]
+		delete(p.done, last.Offset)
+		p.pending = p.pending[1:]
+		advanced = true
+	}
+
+	if advanced {
+		p.since = time.Now()
+		close(t.released)
+		t.released = make(chan struct{})
+	}
+	if !advanced || last.Offset <= p.committed {
+		return kafka.Message{}, false
+	}
+	p.committed = last.Offset
+	return last, true
+}
+
+// Отметка сообщений обработанными и коммит того, что стало можно подтвердить.
+// Смещение коммитится только до последнего сообщения партиции, перед которым всё
+// уже обработано; коммиты идут строго по возрастанию
+func (t *offsetTracker) commit(ctx context.Context, reader MessageReader, msgs ...kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+
+	latest := make(map[int]kafka.Message)
+	for _, msg := range msgs {
+		if toCommit, ok := t.markDone(msg); ok {
+			latest[toCommit.Partition] = toCommit
+		}
+	}
+	if len(latest) == 0 {
+		return nil
+	}
+
+	toCommit := make([]kafka.Message, 0, len(latest))
+	for _, msg := range latest {
+		toCommit = append(toCommit, msg)
+	}
+	return reader.CommitMessages(ctx, toCommit...)
+}
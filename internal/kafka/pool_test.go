@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker_CommitsOnlyContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	msgs := []kafka.Message{
+		{Partition: 0, Offset: 10},
+		{Partition: 0, Offset: 11},
+		{Partition: 0, Offset: 12},
+	}
+	for _, msg := range msgs {
+		tracker.track(msg)
+	}
+
+	if _, ok := tracker.markDone(msgs[2]); ok {
+		t.Error("Offset 12 must not be committed while 10 and 11 are in flight")
+	}
+	if _, ok := tracker.markDone(msgs[1]); ok {
+		t.Error("Offset 11 must not be committed while 10 is in flight")
+	}
+
+	toCommit, ok := tracker.markDone(msgs[0])
+	if !ok {
+		t.Fatal("Expected commit after offset 10 is done")
+	}
+	if toCommit.Offset != 12 {
+		t.Errorf("Expected commit up to offset 12, got %d", toCommit.Offset)
+	}
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tracker := newOffsetTracker()
+	a := kafka.Message{Partition: 0, Offset: 5}
+	b := kafka.Message{Partition: 1, Offset: 3}
+	tracker.track(a)
+	tracker.track(b)
+
+	toCommit, ok := tracker.markDone(b)
+	if !ok || toCommit.Partition != 1 || toCommit.Offset != 3 {
+		t.Errorf("Expected commit of partition 1 offset 3, got %+v (ok=%v)", toCommit, ok)
+	}
+}
+
+func TestOffsetTracker_WaitBelowBlocksUntilCommit(t *testing.T) {
+	tracker := newOffsetTracker()
+	stuck := kafka.Message{Partition: 0, Offset: 1}
+	next := kafka.Message{Partition: 0, Offset: 2}
+	tracker.track(stuck)
+	tracker.track(next)
+
+	// Следующее сообщение обработано, но смещение держит первое
+	tracker.markDone(next)
+
+	waits := 0
+	released := make(chan bool, 1)
+	go func() {
+		released <- tracker.waitBelow(context.Background(), 2, func(uncommitted int) {
+			waits++
+			if uncommitted != 2 {
+				t.Errorf("Expected 2 uncommitted messages, got %v", uncommitted)
+			}
+		})
+	}()
+
+	select {
+	case <-released:
+		t.Fatal("waitBelow must block while the limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tracker.markDone(stuck)
+	select {
+	case ok := <-released:
+		if !ok || waits != 1 {
+			t.Errorf("Expected release after commit with one onWait call, got ok=%v waits=%v", ok, waits)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitBelow was not released after the offset advanced")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.track(kafka.Message{Partition: 0, Offset: 3})
+	cancel()
+	if tracker.waitBelow(ctx, 1, nil) {
+		t.Error("waitBelow must return false when ctx is cancelled")
+	}
+	if !tracker.waitBelow(ctx, 0, nil) {
+		t.Error("Zero limit must not block")
+	}
+}
+
+func TestOffsetTracker_StallsOfWaitingPartitions(t *testing.T) {
+	tracker := newOffsetTracker()
+	stuck := kafka.Message{Partition: 0, Offset: 1}
+	done := kafka.Message{Partition: 1, Offset: 1}
+	tracker.track(stuck)
+	tracker.track(kafka.Message{Partition: 0, Offset: 2})
+	tracker.track(done)
+	tracker.markDone(done)
+
+	stalls := tracker.stalls(time.Now().Add(time.Minute))
+	if stalls[0] < time.Minute {
+		t.Errorf("Partition 0 waits for offset 1 and must be stalled, got %v", stalls[0])
+	}
+	if got, ok := stalls[1]; !ok || got != 0 {
+		t.Errorf("Partition 1 has nothing pending and must report 0, got %v (ok=%v)", got, ok)
+	}
+
+	tracker.markDone(stuck)
+	if stalls := tracker.stalls(time.Now()); stalls[0] >= time.Minute {
+		t.Errorf("Stall must restart once the offset advances, got %v", stalls[0])
+	}
+
+	tracker.reset()
+	if n := tracker.uncommitted(); n != 0 {
+		t.Errorf("Expected no uncommitted messages after reset, got %v", n)
+	}
+}
+
+func TestWorkerPool_PreservesOrderPerKey(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+
+	pool := newWorkerPool(4, 3, time.Millisecond, func(msgs []kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range msgs {
+			seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+		}
+	})
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := int64(0); i < 100; i++ {
+		key := keys[i%int64(len(keys))]
+		pool.dispatch(context.Background(), kafka.Message{Key: []byte(key), Offset: i})
+	}
+	pool.stop()
+
+	for key, offsets := range seen {
+		if len(offsets) != 20 {
+			t.Errorf("Key %s: expected 20 messages, got %d", key, len(offsets))
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("Key %s processed out of order: %v", key, offsets)
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPool_FlushesBatchBySizeAndTimeout(t *testing.T) {
+	batches := make(chan int, 10)
+	pool := newWorkerPool(1, 3, 20*time.Millisecond, func(msgs []kafka.Message) {
+		batches <- len(msgs)
+	})
+	defer pool.stop()
+
+	for i := int64(0); i < 4; i++ {
+		pool.dispatch(context.Background(), kafka.Message{Key: []byte("k"), Offset: i})
+	}
+
+	if got := <-batches; got != 3 {
+		t.Errorf("Expected full batch of 3, got %d", got)
+	}
+	select {
+	case got := <-batches:
+		if got != 1 {
+			t.Errorf("Expected partial batch of 1 after timeout, got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("Partial batch was not flushed after timeout")
+	}
+}
+
+func TestOrderingKey_FallsBackToOrderUID(t *testing.T) {
+	msg := kafka.Message{Value: []byte(`{"order_uid":"uid-1"}`)}
+	if got := orderingKey(msg); got != "uid-1" {
+		t.Errorf("Expected ordering key uid-1, got %q", got)
+	}
+}
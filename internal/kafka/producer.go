@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заказ для публикации: тело в JSON и значения ключа и заголовков
+type OrderMessage struct {
+	OrderUID string
+	EventID  string
+	Version  int64
+	Payload  []byte
+}
+
+// OrderProducer публикует заказы в топик в том виде, в каком их ждёт консьюмер:
+// ключ — order_uid, заголовки event-id, event-version и content-type
+type OrderProducer struct {
+	writer MessageWriter
+	topic  string
+}
+
+func NewOrderProducer(brokers []string, topic string, security SecurityConfig) (*OrderProducer, error) {
+	transport, err := security.transport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure producer transport: %w", err)
+	}
+
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+		// Пачки собирает вызывающий, ждать добора до BatchSize не нужно
+		BatchTimeout:           10 * time.Millisecond,
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		Transport:              transport,
+	}
+
+	return NewOrderProducerWithWriter(writer, topic), nil
+}
+
+// Создание продюсера поверх произвольного писателя (например, фейкового в тестах)
+func NewOrderProducerWithWriter(writer MessageWriter, topic string) *OrderProducer {
+	return &OrderProducer{writer: writer, topic: topic}
+}
+
+func (p *OrderProducer) Publish(ctx context.Context, msgs ...OrderMessage) error {
+	kafkaMsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		kafkaMsgs[i] = kafka.Message{
+			Key:   []byte(msg.OrderUID),
+			Value: msg.Payload,
+			Headers: []kafka.Header{
+				{Key: HeaderEventID, Value: []byte(msg.EventID)},
+				{Key: HeaderEventVersion, Value: []byte(strconv.FormatInt(msg.Version, 10))},
+				{Key: HeaderContentType, Value: []byte(ContentTypeJSON)},
+			},
+		}
+	}
+
+	if err := p.writer.WriteMessages(ctx, kafkaMsgs...); err != nil {
+		return fmt.Errorf("failed to publish orders to %v: %w", p.topic, err)
+	}
+	return nil
+}
+
+func (p *OrderProducer) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,176 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"l0/internal/model"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Декодер Protobuf в Confluent wire format. Схема из registry (.proto-исходник) компилируется
+// на лету, нужное сообщение выбирается по индексам из префикса. Имена полей в .proto
+// должны совпадать с JSON-контрактом; date_created — строка RFC 3339 или google.protobuf.Timestamp
+type ProtobufDecoder struct {
+	registry SchemaRegistry
+	files    *schemaCache[protoreflect.FileDescriptor]
+}
+
+func NewProtobufDecoder(registry SchemaRegistry) *ProtobufDecoder {
+	return &ProtobufDecoder{
+		registry: registry,
+		files:    newSchemaCache[protoreflect.FileDescriptor](),
+	}
+}
+
+func (d *ProtobufDecoder) Decode(ctx context.Context, msg kafka.Message) (model.Order, error) {
+	schemaID, body, err := parseWireFormat(msg.Value)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	indexes, body, err := readMessageIndexes(body)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	file, err := d.file(ctx, schemaID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	desc, err := messageByIndexes(file, indexes)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("schema %v: %w", schemaID, err)
+	}
+
+	message := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(body, message); err != nil {
+		return model.Order{}, fmt.Errorf("failed to decode protobuf message: %w", err)
+	}
+
+	return orderFromNative(protoToNative(message))
+}
+
+func (d *ProtobufDecoder) file(ctx context.Context, schemaID int) (protoreflect.FileDescriptor, error) {
+	return d.files.get(ctx, schemaID, func(ctx context.Context) (protoreflect.FileDescriptor, error) {
+		return d.compile(ctx, schemaID)
+	})
+}
+
+func (d *ProtobufDecoder) compile(ctx context.Context, schemaID int) (protoreflect.FileDescriptor, error) {
+	schema, err := d.registry.GetSchema(ctx, schemaID)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != SchemaTypeProtobuf {
+		return nil, fmt.Errorf("schema %v is %v, not protobuf", schemaID, schema.Type)
+	}
+
+	const fileName = "schema.proto"
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{fileName: schema.Definition}),
+		}),
+	}
+	files, err := compiler.Compile(ctx, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile protobuf schema %v: %w", schemaID, err)
+	}
+
+	return files[0], nil
+}
+
+// Индексы сообщения внутри .proto-файла: число индексов и сами индексы в zigzag varint.
+// Одиночный 0 означает первое сообщение верхнего уровня
+func readMessageIndexes(body []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(body)
+	if n <= 0 || count < 0 {
+		return nil, nil, errors.New("invalid protobuf message indexes")
+	}
+	body = body[n:]
+	if count == 0 {
+		return []int{0}, body, nil
+	}
+
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(body)
+		if n <= 0 || index < 0 {
+			return nil, nil, errors.New("invalid protobuf message indexes")
+		}
+		indexes = append(indexes, int(index))
+		body = body[n:]
+	}
+	return indexes, body, nil
+}
+
+func messageByIndexes(file protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+	messages := file.Messages()
+	var desc protoreflect.MessageDescriptor
+	for _, index := range indexes {
+		if index >= messages.Len() {
+			return nil, fmt.Errorf("message index %v out of range", index)
+		}
+		desc = messages.Get(index)
+		messages = desc.Messages()
+	}
+	return desc, nil
+}
+
+// Перевод сообщения в map с именами полей из .proto. В отличие от protojson,
+// int64 остаются числами, а Timestamp превращается в time.Time
+func protoToNative(message protoreflect.Message) interface{} {
+	if message.Descriptor().FullName() == "google.protobuf.Timestamp" {
+		fields := message.Descriptor().Fields()
+		seconds := message.Get(fields.ByName("seconds")).Int()
+		nanos := message.Get(fields.ByName("nanos")).Int()
+		return time.Unix(seconds, nanos).UTC()
+	}
+
+	result := make(map[string]interface{})
+	message.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		result[string(fd.Name())] = protoValueToNative(fd, value)
+		return true
+	})
+	return result
+}
+
+func protoValueToNative(fd protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := value.List()
+		items := make([]interface{}, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			items = append(items, protoScalarToNative(fd, list.Get(i)))
+		}
+		return items
+	case fd.IsMap():
+		result := make(map[string]interface{})
+		value.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+			result[key.String()] = protoScalarToNative(fd.MapValue(), v)
+			return true
+		})
+		return result
+	default:
+		return protoScalarToNative(fd, value)
+	}
+}
+
+func protoScalarToNative(fd protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoToNative(value.Message())
+	case protoreflect.EnumKind:
+		return int32(value.Enum())
+	default:
+		return value.Interface()
+	}
+}
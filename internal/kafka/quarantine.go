@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"l0/internal/db"
+	"l0/internal/metrics"
+	"l0/internal/model"
+	"l0/internal/tracing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Ошибка повторной обработки сообщения из карантина: сообщение не прошло
+// десериализацию или валидацию и без исправления сохранено не будет
+type ProcessingError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ProcessingError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Class, e.Err)
+}
+
+func (e *ProcessingError) Unwrap() error {
+	return e.Err
+}
+
+// Сохранение сообщения в карантин. Возвращает false, если карантин не настроен или недоступен
+func (c *Consumer) quarantineMessage(ctx context.Context, msg kafka.Message, class ErrorClass, cause error, attempts int) bool {
+	if c.quarantine == nil {
+		return false
+	}
+
+	if err := c.quarantine.Quarantine(ctx, toQuarantined(msg, class, cause, attempts)); err != nil {
+		c.logger.Printf("Ошибка сохранения сообщения offset=%v в карантин: %v", msg.Offset, err)
+		return false
+	}
+
+	c.logger.Printf("Сообщение partition=%v offset=%v помещено в карантин (%v): %v",
+		msg.Partition, msg.Offset, class, cause)
+	return true
+}
+
+// Повторная обработка сообщения из карантина тем же путём, что и сообщения из топика.
+// Ошибка возвращается вызывающему, а сообщение не отправляется ни в DLQ, ни снова
+// в карантин
+func (c *Consumer) Reprocess(ctx context.Context, entry db.QuarantinedMessage) (string, error) {
+	msg := fromQuarantined(entry)
+	ctx, span := startMessageSpan(ctx, msg)
+	defer span.End()
+
+	result, err := c.process(ctx, msg)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return "", err
+	}
+	c.logger.Printf("Сообщение %v из карантина обработано: %v", entry.ID, result)
+	return result, nil
+}
+
+// Обработка одного сообщения: десериализация, валидация, сохранение в БД и обновление
+// кэша. В отличие от processMessage, ошибка не уходит в DLQ и карантин, а возвращается:
+// ошибки десериализации и валидации имеют тип *ProcessingError, ошибки БД обёрнуты.
+// Возвращает итог обработки: saved, deleted, duplicate или stale
+func (c *Consumer) process(ctx context.Context, msg kafka.Message) (string, error) {
+	if isTombstone(msg) {
+		orderUID := string(msg.Key)
+		if orderUID == "" {
+			return "", &ProcessingError{Class: ErrorClassDecode, Err: errors.New("tombstone without order_uid key")}
+		}
+
+		_, err := c.removeOrder(ctx, msg, orderUID)
+		if errors.Is(err, db.ErrDuplicate) {
+			c.duplicate(msg, model.Order{OrderUID: orderUID})
+			return metrics.ResultDuplicate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to delete order %v: %w", orderUID, err)
+		}
+		c.evictCache(ctx, orderUID)
+		c.metrics.Processed(msg.Topic, metrics.ResultDeleted)
+		return metrics.ResultDeleted, nil
+	}
+
+	order, class, err := c.decodeMessage(ctx, msg)
+	if errors.Is(err, ErrRegistryUnavailable) {
+		// Само сообщение может быть корректным: повторить позже
+		return "", fmt.Errorf("failed to decode message: %w", err)
+	}
+	if err != nil {
+		return "", &ProcessingError{Class: class, Err: err}
+	}
+
+	_, err = c.persistOrder(ctx, msg, order)
+	if errors.Is(err, db.ErrDuplicate) {
+		c.duplicate(msg, order)
+		return metrics.ResultDuplicate, nil
+	}
+	if errors.Is(err, db.ErrStale) {
+		c.stale(msg, order)
+		return metrics.ResultStale, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save order %v: %w", order.OrderUID, err)
+	}
+
+	c.updateCache(ctx, order)
+	c.metrics.Processed(msg.Topic, metrics.ResultSaved)
+	return metrics.ResultSaved, nil
+}
+
+func toQuarantined(msg kafka.Message, class ErrorClass, cause error, attempts int) db.QuarantinedMessage {
+	headers := make([]db.MessageHeader, len(msg.Headers))
+	for i, h := range msg.Headers {
+		headers[i] = db.MessageHeader{Key: h.Key, Value: h.Value}
+	}
+	detail := ""
+	if cause != nil {
+		detail = cause.Error()
+	}
+	return db.QuarantinedMessage{
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Key:        msg.Key,
+		Value:      msg.Value,
+		Headers:    headers,
+		ErrorClass: string(class),
+		Error:      detail,
+		Attempts:   attempts,
+	}
+}
+
+func fromQuarantined(entry db.QuarantinedMessage) kafka.Message {
+	headers := make([]kafka.Header, len(entry.Headers))
+	for i, h := range entry.Headers {
+		headers[i] = kafka.Header{Key: h.Key, Value: h.Value}
+	}
+	return kafka.Message{
+		Topic:     entry.Topic,
+		Partition: entry.Partition,
+		Offset:    entry.Offset,
+		Key:       entry.Key,
+		Value:     entry.Value,
+		Headers:   headers,
+	}
+}
@@ -0,0 +1,136 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"l0/internal/db"
+	"l0/internal/model"
+	"l0/internal/validation"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type MockQuarantineStore struct {
+	quarantineFn func(ctx context.Context, msg db.QuarantinedMessage) error
+	quarantined  []db.QuarantinedMessage
+}
+
+func (m *MockQuarantineStore) Quarantine(ctx context.Context, msg db.QuarantinedMessage) error {
+	if m.quarantineFn != nil {
+		if err := m.quarantineFn(ctx, msg); err != nil {
+			return err
+		}
+	}
+	m.quarantined = append(m.quarantined, msg)
+	return nil
+}
+
+func (m *MockQuarantineStore) ListQuarantined(ctx context.Context, afterID int64, limit int) ([]db.QuarantinedMessage, error) {
+	return m.quarantined, nil
+}
+
+func (m *MockQuarantineStore) GetQuarantined(ctx context.Context, id int64) (*db.QuarantinedMessage, error) {
+	return nil, db.ErrNotQuarantined
+}
+
+func (m *MockQuarantineStore) DeleteQuarantined(ctx context.Context, id int64) error {
+	return nil
+}
+
+func TestConsumer_ProcessMessage_RejectedMessageGoesToQuarantine(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, reader, _ := newTestConsumer(&MockOrderStore{}, writer)
+	store := &MockQuarantineStore{}
+	c.quarantine = store
+
+	handle(c, kafka.Message{
+		Topic: "orders", Partition: 1, Offset: 7, Key: []byte("k"), Value: []byte("{not json"),
+		Headers: []kafka.Header{{Key: HeaderEventID, Value: []byte("e1")}},
+	})
+
+	if len(store.quarantined) != 1 {
+		t.Fatalf("Expected 1 quarantined message, got %d", len(store.quarantined))
+	}
+	got := store.quarantined[0]
+	if got.Topic != "orders" || got.Partition != 1 || got.Offset != 7 || string(got.Value) != "{not json" {
+		t.Errorf("Quarantined message must keep source position and payload, got %+v", got)
+	}
+	if got.ErrorClass != string(ErrorClassDecode) || got.Error == "" || got.Attempts != 1 {
+		t.Errorf("Unexpected error details: %+v", got)
+	}
+	if len(got.Headers) != 1 || string(got.Headers[0].Value) != "e1" {
+		t.Errorf("Headers must be kept, got %+v", got.Headers)
+	}
+	if len(writer.written) != 1 || len(reader.committed) != 1 {
+		t.Errorf("Expected DLQ publish and commit, got %d and %d", len(writer.written), len(reader.committed))
+	}
+}
+
+func TestConsumer_ProcessMessage_QuarantineWithoutDLQCommits(t *testing.T) {
+	c, reader, _ := newTestConsumer(&MockOrderStore{}, &MockMessageWriter{})
+	c.dlq = nil
+	store := &MockQuarantineStore{}
+	c.quarantine = store
+
+	handle(c, kafka.Message{Value: []byte("garbage")})
+	if len(reader.committed) != 1 {
+		t.Errorf("Offset must be committed once message is quarantined, got %d commits", len(reader.committed))
+	}
+
+	store.quarantineFn = func(ctx context.Context, msg db.QuarantinedMessage) error {
+		return errors.New("db unavailable")
+	}
+	// Запись повторяется, пока не отменится контекст
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg := kafka.Message{Offset: 1, Value: []byte("garbage")}
+	c.offsets.track(msg)
+	c.handleBatch(ctx, []kafka.Message{msg})
+	if len(reader.committed) != 1 {
+		t.Errorf("Offset must not be committed when neither quarantine nor DLQ accepted the message")
+	}
+}
+
+func TestConsumer_Reprocess(t *testing.T) {
+	var saved []model.Order
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			saved = append(saved, ord)
+			return nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, _, cached := newTestConsumer(store, writer)
+	c.val = newTestValidator()
+	quarantine := &MockQuarantineStore{}
+	c.quarantine = quarantine
+
+	// Ошибка валидации возвращается вызывающему, а не уходит снова в DLQ и карантин
+	_, err := c.Reprocess(context.Background(), db.QuarantinedMessage{Topic: "orders", Value: []byte(`{"order_uid":"r-1"}`)})
+	var procErr *ProcessingError
+	if !errors.As(err, &procErr) || procErr.Class != ErrorClassValidate {
+		t.Fatalf("Expected validation ProcessingError, got %v", err)
+	}
+	var fieldErrors validation.Errors
+	if !errors.As(err, &fieldErrors) || fieldErrors[0].Field != "order_uid" || fieldErrors[0].Rule != "uuid" {
+		t.Errorf("Expected structured field errors, got %v", err)
+	}
+	if len(saved) != 0 || len(writer.written) != 0 || len(quarantine.quarantined) != 0 {
+		t.Errorf("Invalid message must not be saved or rejected again")
+	}
+
+	fixed := newTestMessage(t, "r-1")
+	c.val = nil
+	result, err := c.Reprocess(context.Background(), db.QuarantinedMessage{Topic: "orders", Value: fixed.Value})
+	if err != nil || result != "saved" {
+		t.Fatalf("Expected saved result, got %q, %v", result, err)
+	}
+	if len(saved) != 1 || saved[0].OrderUID != "r-1" {
+		t.Errorf("Expected order to be saved, got %+v", saved)
+	}
+	if _, ok := cached.GetOrder("r-1"); !ok {
+		t.Error("Reprocessed order should be cached")
+	}
+}
@@ -0,0 +1,316 @@
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"l0/internal/db"
+	"l0/internal/metrics"
+	"l0/internal/validation"
+	"log"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplaySource — источник сообщений для повторной загрузки. io.EOF — сообщения закончились
+type ReplaySource interface {
+	Next(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// Итоги повторной загрузки
+type ReplayReport struct {
+	Total    int
+	Valid    int
+	Saved    int
+	Deleted  int
+	Stale    int
+	Failed   map[ErrorClass]int
+	Failures []ReplayFailure
+}
+
+type ReplayFailure struct {
+	Partition int
+	Offset    int64 // для файла — номер строки
+	Class     ErrorClass
+	Err       error
+}
+
+// Replayer прогоняет сообщения через тот же конвейер, что и консьюмер:
+// декодирование, валидация и сохранение в БД. Журнал обработанных сообщений
+// не ведётся, иначе уже прочитанные из топика сообщения считались бы повторами;
+// DLQ не используется — ошибки попадают в отчёт. Кэша у Replayer нет: сервис
+// загрузит заказ из БД при первом запросе
+type Replayer struct {
+	consumer *Consumer
+	dryRun   bool
+}
+
+// repo не нужен в режиме dry-run и может быть nil
+func NewReplayer(repo db.OrderStore, decoder Decoder, validator *validation.Validator, retry RetryPolicy, dryRun bool, logger *log.Logger) *Replayer {
+	if decoder == nil {
+		decoder = JSONDecoder{}
+	}
+
+	return &Replayer{
+		consumer: &Consumer{
+			repo:       repo,
+			decoder:    decoder,
+			retry:      retry,
+			offsets:    newOffsetTracker(),
+			control:    newConsumerControl(),
+			skipLedger: true,
+			logger:     logger,
+			val:        validator,
+		},
+		dryRun: dryRun,
+	}
+}
+
+func (r *Replayer) Run(ctx context.Context, source ReplaySource) (ReplayReport, error) {
+	report := ReplayReport{Failed: make(map[ErrorClass]int)}
+
+	for {
+		msg, err := source.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Total++
+
+		if r.dryRun {
+			r.validate(ctx, msg, &report)
+			continue
+		}
+
+		result, err := r.consumer.process(ctx, msg)
+		var procErr *ProcessingError
+		switch {
+		case errors.As(err, &procErr):
+			report.fail(msg, procErr.Class, procErr.Err)
+			continue
+		case err != nil:
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.fail(msg, ErrorClassPersist, err)
+			continue
+		}
+
+		report.Valid++
+		switch result {
+		case metrics.ResultSaved:
+			report.Saved++
+		case metrics.ResultDeleted:
+			report.Deleted++
+		case metrics.ResultStale:
+			report.Stale++
+		}
+	}
+}
+
+// Режим dry-run: только десериализация и валидация
+func (r *Replayer) validate(ctx context.Context, msg kafka.Message, report *ReplayReport) {
+	if isTombstone(msg) {
+		if len(msg.Key) == 0 {
+			report.fail(msg, ErrorClassDecode, errors.New("tombstone without order_uid key"))
+			return
+		}
+		report.Valid++
+		return
+	}
+
+	if _, class, err := r.consumer.decodeMessage(ctx, msg); err != nil {
+		report.fail(msg, class, err)
+		return
+	}
+	report.Valid++
+}
+
+func (r *ReplayReport) fail(msg kafka.Message, class ErrorClass, err error) {
+	r.Failed[class]++
+	r.Failures = append(r.Failures, ReplayFailure{
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Class:     class,
+		Err:       err,
+	})
+}
+
+// Заказы из JSONL-файла: по одному JSON на строку, пустые строки пропускаются.
+// Номер строки служит смещением сообщения
+type FileSource struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	path    string
+	line    int64
+}
+
+func NewFileSource(path string) (*FileSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return &FileSource{file: file, scanner: scanner, path: path}, nil
+}
+
+func (s *FileSource) Next(ctx context.Context) (kafka.Message, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		return kafka.Message{
+			Topic:  s.path,
+			Offset: s.line,
+			Value:  bytes.Clone(line),
+			Time:   time.Now(),
+		}, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to read replay file: %w", err)
+	}
+	return kafka.Message{}, io.EOF
+}
+
+func (s *FileSource) Close() error {
+	return s.file.Close()
+}
+
+// Диапазон сообщений топика. Границы по смещениям и по времени можно сочетать
+type TopicRange struct {
+	Partitions []int     // пусто — все партиции
+	FromOffset int64     // отрицательное — с начала партиции
+	ToOffset   int64     // включительно; отрицательное — до конца партиции
+	From       time.Time // нулевое — без ограничения
+	To         time.Time
+}
+
+// Сообщения топика из заданного диапазона, партиция за партицией. Читается без
+// группы консьюмеров, поэтому смещения основной группы не меняются
+type TopicSource struct {
+	cfg        Config
+	rng        TopicRange
+	partitions []int
+	reader     *kafka.Reader
+}
+
+func NewTopicSource(ctx context.Context, cfg Config, rng TopicRange) (*TopicSource, error) {
+	partitions := rng.Partitions
+	if len(partitions) == 0 {
+		admin, err := newBrokerOffsetAdmin(cfg.Brokers, cfg.Security)
+		if err != nil {
+			return nil, err
+		}
+		partitions, err = admin.partitions(ctx, cfg.Topic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &TopicSource{cfg: cfg, rng: rng, partitions: partitions}, nil
+}
+
+func (s *TopicSource) Next(ctx context.Context) (kafka.Message, error) {
+	for {
+		if s.reader == nil {
+			if len(s.partitions) == 0 {
+				return kafka.Message{}, io.EOF
+			}
+			more, err := s.openPartition(ctx, s.partitions[0])
+			s.partitions = s.partitions[1:]
+			if err != nil {
+				return kafka.Message{}, err
+			}
+			if !more {
+				s.closeReader()
+				continue
+			}
+		}
+
+		msg, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			return kafka.Message{}, fmt.Errorf("failed to read partition %v: %w", s.reader.Config().Partition, err)
+		}
+
+		last := msg.Offset+1 >= msg.HighWaterMark
+		if s.rng.ToOffset >= 0 && msg.Offset >= s.rng.ToOffset {
+			last = true
+		}
+		if !s.rng.To.IsZero() && msg.Time.After(s.rng.To) {
+			s.closeReader()
+			continue
+		}
+		if last {
+			s.closeReader()
+		}
+		return msg, nil
+	}
+}
+
+// Установка начального смещения партиции. false — в диапазоне нет сообщений
+func (s *TopicSource) openPartition(ctx context.Context, partition int) (bool, error) {
+	readerCfg, err := s.cfg.readerConfig()
+	if err != nil {
+		return false, err
+	}
+	readerCfg.GroupID = ""
+	readerCfg.Partition = partition
+	s.reader = kafka.NewReader(readerCfg)
+
+	switch {
+	case !s.rng.From.IsZero():
+		err = s.reader.SetOffsetAt(ctx, s.rng.From)
+	case s.rng.FromOffset >= 0:
+		err = s.reader.SetOffset(s.rng.FromOffset)
+	default:
+		err = s.reader.SetOffset(kafka.FirstOffset)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set start offset of partition %v: %w", partition, err)
+	}
+	// Offset() может вернуть служебное значение (-1, -2), если начальное смещение не известно
+	offset := s.reader.Offset()
+	if !s.rng.From.IsZero() && s.rng.FromOffset >= 0 && offset >= 0 && offset < s.rng.FromOffset {
+		if err := s.reader.SetOffset(s.rng.FromOffset); err != nil {
+			return false, fmt.Errorf("failed to set start offset of partition %v: %w", partition, err)
+		}
+	}
+
+	// Без лага FetchMessage ждал бы новых сообщений бесконечно
+	lag, err := s.reader.ReadLag(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to read lag of partition %v: %w", partition, err)
+	}
+	if lag <= 0 {
+		return false, nil
+	}
+	if offset = s.reader.Offset(); s.rng.ToOffset >= 0 && offset >= 0 && offset > s.rng.ToOffset {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *TopicSource) closeReader() {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+func (s *TopicSource) Close() error {
+	s.closeReader()
+	return nil
+}
@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"l0/internal/db"
+	"l0/internal/model"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReplayOrder(uid string) model.Order {
+	return model.Order{
+		OrderUID:          uid,
+		TrackNumber:       "WBILMTESTTRACK",
+		Entry:             "WBIL",
+		Locale:            "en",
+		InternalSignature: "sig",
+		CustomerID:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SMID:              99,
+		DateCreated:       time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:          "1",
+		Delivery: model.Delivery{
+			Name:    "Test Testov",
+			Phone:   "89000000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: model.Payment{
+			Transaction:  uid,
+			RequestID:    "req",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+			CustomFee:    1,
+		},
+		Items: []model.Item{{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453,
+			RID:         "ab4219087a764ae0btest",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NMID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      1,
+		}},
+	}
+}
+
+// JSONL: корректный заказ, битый JSON, заказ без обязательных полей и ещё один корректный
+func writeReplayFile(t *testing.T) string {
+	lines := []string{"", "{not json", `{"order_uid":"b563feb7-b2b8-4b6a-9f5d-000000000002"}`, ""}
+	for i, uid := range []string{"b563feb7-b2b8-4b6a-9f5d-000000000001", "b563feb7-b2b8-4b6a-9f5d-000000000003"} {
+		data, err := json.Marshal(newReplayOrder(uid))
+		if err != nil {
+			t.Fatalf("Failed to marshal order: %v", err)
+		}
+		lines[i*3] = string(data)
+	}
+
+	path := filepath.Join(t.TempDir(), "orders.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write replay file: %v", err)
+	}
+	return path
+}
+
+func replayFile(t *testing.T, store db.OrderStore, dryRun bool) ReplayReport {
+	source, err := NewFileSource(writeReplayFile(t))
+	if err != nil {
+		t.Fatalf("NewFileSource failed: %v", err)
+	}
+	defer source.Close()
+
+	replayer := NewReplayer(store, nil, newTestValidator(), newTestRetryPolicy(), dryRun, log.New(io.Discard, "", 0))
+
+	report, err := replayer.Run(context.Background(), source)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return report
+}
+
+func TestReplayer_DryRunOnlyValidates(t *testing.T) {
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			t.Fatal("dry run must not save orders")
+			return nil
+		},
+	}
+
+	report := replayFile(t, store, true)
+
+	if report.Total != 4 || report.Valid != 2 || report.Saved != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if report.Failed[ErrorClassDecode] != 1 || report.Failed[ErrorClassValidate] != 1 {
+		t.Errorf("Expected one decode and one validation failure, got %v", report.Failed)
+	}
+	// Смещение сообщения из файла — номер строки
+	if report.Failures[0].Offset != 2 || report.Failures[1].Offset != 3 {
+		t.Errorf("Expected failures on lines 2 and 3, got %+v", report.Failures)
+	}
+}
+
+func TestReplayer_SavesWithoutLedger(t *testing.T) {
+	var saved []string
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			if len(refs) != 0 {
+				t.Errorf("Replay must not write the message ledger, got refs %v", refs)
+			}
+			if ord.OrderUID == "b563feb7-b2b8-4b6a-9f5d-000000000003" {
+				return db.ErrStale
+			}
+			saved = append(saved, ord.OrderUID)
+			return nil
+		},
+	}
+
+	report := replayFile(t, store, false)
+
+	if report.Saved != 1 || report.Stale != 1 || len(report.Failures) != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if len(saved) != 1 {
+		t.Errorf("Expected one saved order, got %v", saved)
+	}
+}
+
+func TestReplayer_ReportsPersistFailures(t *testing.T) {
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			return db.ErrConflict
+		},
+	}
+
+	report := replayFile(t, store, false)
+
+	if report.Saved != 0 || report.Failed[ErrorClassPersist] != 2 {
+		t.Errorf("Expected both valid orders to fail on save, got %+v", report)
+	}
+	if !errors.Is(report.Failures[0].Err, db.ErrConflict) {
+		t.Errorf("Failure must keep the store error, got %v", report.Failures[0].Err)
+	}
+}
@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"l0/internal/db"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Временная ли ошибка: репозиторий вернул ErrUnavailable, драйвер БД сообщил
+// о сетевом сбое, таймауте пула, сериализации или дедлоке, либо не ответил
+// Schema Registry. ErrConflict, ErrNotFound и прочие ошибки данных считаются
+// постоянными и не повторяются
+func IsTransient(err error) bool {
+	return db.IsUnavailable(err) || errors.Is(err, ErrRegistryUnavailable)
+}
+
+// Политика повторов с экспоненциальной задержкой и джиттером
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64       // доля случайного разброса задержки, от 0 до 1
+	MaxElapsedTime  time.Duration // общий бюджет на повторы, 0 — без повторов
+	// Какие ошибки повторять; nil — только временные (IsTransient)
+	Retryable func(err error) bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 200 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxElapsedTime:  2 * time.Minute,
+	}
+}
+
+// Выполняет fn, повторяя её при временных ошибках, пока не кончится бюджет или контекст.
+// Возвращает число сделанных попыток и последнюю ошибку
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, onRetry func(attempt int, err error, wait time.Duration)) (int, error) {
+	start := time.Now()
+	interval := p.InitialInterval
+	attempt := 0
+
+	for {
+		attempt++
+		err := fn()
+		if err == nil || !p.retryable(err) {
+			return attempt, err
+		}
+
+		wait := p.jittered(interval)
+		if time.Since(start)+wait > p.MaxElapsedTime {
+			return attempt, err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+
+		interval = time.Duration(float64(interval) * p.Multiplier)
+		if p.MaxInterval > 0 && interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// Отклонённое сообщение нельзя подтвердить, пока оно не сохранено в карантин или DLQ,
+// а без подтверждения смещение партиции не сдвигается. Поэтому запись повторяется
+// при любой ошибке, пока не удастся или не отменится ctx, с задержками политики p
+func rejectPolicy(p RetryPolicy) RetryPolicy {
+	p.MaxElapsedTime = math.MaxInt64
+	p.Retryable = func(error) bool { return true }
+	return p
+}
+
+func (p RetryPolicy) jittered(interval time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return interval
+	}
+	delta := p.Jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+}
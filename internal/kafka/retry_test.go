@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"l0/internal/db"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func newTestRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxElapsedTime:  time.Second,
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("failed to save order: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"connection exception", &pgconn.PgError{Code: "08006"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"connection refused", fmt.Errorf("failed to begin transaction: %w", syscall.ECONNREFUSED), true},
+		{"pool timeout", fmt.Errorf("failed to begin transaction: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"plain error", errors.New("bad data"), false},
+		{"unavailable", fmt.Errorf("failed to save order: %w", db.ErrUnavailable), true},
+		{"conflict", fmt.Errorf("%w: %w", db.ErrConflict, &pgconn.PgError{Code: "23505"}), false},
+		{"not found", db.ErrItemNotFound, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRetryPolicy_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	attempts, err := newTestRetryPolicy().Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	}, nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if attempts != 3 || calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d (calls %d)", attempts, calls)
+	}
+}
+
+func TestRetryPolicy_StopsOnPermanentError(t *testing.T) {
+	calls := 0
+	attempts, err := newTestRetryPolicy().Do(context.Background(), func() error {
+		calls++
+		return &pgconn.PgError{Code: "23505"}
+	}, nil)
+
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if attempts != 1 || calls != 1 {
+		t.Errorf("Permanent error must not be retried, got %d attempts", attempts)
+	}
+}
+
+func TestRetryPolicy_RespectsMaxElapsedTime(t *testing.T) {
+	policy := newTestRetryPolicy()
+	policy.MaxElapsedTime = 20 * time.Millisecond
+
+	start := time.Now()
+	attempts, err := policy.Do(context.Background(), func() error {
+		return syscall.ECONNREFUSED
+	}, nil)
+
+	if err == nil {
+		t.Fatal("Expected error after budget is exhausted")
+	}
+	if attempts < 2 {
+		t.Errorf("Expected several attempts, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Retry took too long: %v", elapsed)
+	}
+}
@@ -0,0 +1,186 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Тип схемы в терминах Confluent Schema Registry
+type SchemaType string
+
+const (
+	SchemaTypeAvro     SchemaType = "AVRO"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+	SchemaTypeJSON     SchemaType = "JSON"
+)
+
+type Schema struct {
+	ID         int
+	Type       SchemaType
+	Definition string
+}
+
+// ErrRegistryUnavailable — registry не ответил (сетевая ошибка, таймаут, 5xx или 429).
+// Сообщение при этом может быть корректным, поэтому ошибка временная и повторяется
+var ErrRegistryUnavailable = errors.New("schema registry unavailable")
+
+// SchemaRegistry — получение схемы по ID из префикса сообщения
+type SchemaRegistry interface {
+	GetSchema(ctx context.Context, id int) (Schema, error)
+}
+
+// Клиент Schema Registry, совместимый с Confluent API. Схемы неизменяемы, поэтому кэшируются навсегда
+type RegistryClient struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.RWMutex
+	schemas map[int]Schema
+}
+
+func NewRegistryClient(baseURL, username, password string) *RegistryClient {
+	return &RegistryClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		schemas:  make(map[int]Schema),
+	}
+}
+
+func (r *RegistryClient) GetSchema(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%v/schemas/ids/%v", r.baseURL, id), nil)
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to build schema request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to fetch schema %v: %w: %w", id, ErrRegistryUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return Schema{}, fmt.Errorf("failed to fetch schema %v: %w: registry returned %v", id, ErrRegistryUnavailable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Schema{}, fmt.Errorf("failed to fetch schema %v: registry returned %v", id, resp.Status)
+	}
+
+	var body struct {
+		Schema     string     `json:"schema"`
+		SchemaType SchemaType `json:"schemaType"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Schema{}, fmt.Errorf("failed to decode schema %v: %w", id, err)
+	}
+
+	// Registry не возвращает schemaType для Avro
+	if body.SchemaType == "" {
+		body.SchemaType = SchemaTypeAvro
+	}
+	schema = Schema{ID: id, Type: body.SchemaType, Definition: body.Schema}
+
+	r.mu.Lock()
+	r.schemas[id] = schema
+	r.mu.Unlock()
+
+	return schema, nil
+}
+
+// Кэш разобранных схем (кодеков, дескрипторов) по ID. Схема загружается без блокировки
+// кэша: сообщения с уже известными схемами не ждут чужой запрос к registry, а одновременные
+// запросы одной схемы объединяются в один
+type schemaCache[T any] struct {
+	mu     sync.RWMutex
+	parsed map[int]T
+	group  singleflight.Group
+}
+
+func newSchemaCache[T any]() *schemaCache[T] {
+	return &schemaCache[T]{parsed: make(map[int]T)}
+}
+
+// Разобранная схема из кэша, а если её нет — результат load. Загрузка общая для всех
+// ждущих этой схемы, поэтому не прерывается отменой ctx первого из них; каждый
+// ждущий при отмене своего ctx возвращается сразу
+func (c *schemaCache[T]) get(ctx context.Context, schemaID int, load func(ctx context.Context) (T, error)) (T, error) {
+	c.mu.RLock()
+	parsed, ok := c.parsed[schemaID]
+	c.mu.RUnlock()
+	if ok {
+		return parsed, nil
+	}
+
+	loadCtx := context.WithoutCancel(ctx)
+	result := c.group.DoChan(strconv.Itoa(schemaID), func() (interface{}, error) {
+		parsed, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.parsed[schemaID] = parsed
+		c.mu.Unlock()
+		return parsed, nil
+	})
+
+	var zero T
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Registry в памяти процесса: для тестов и локального запуска без внешнего сервиса
+type MemorySchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[int]Schema
+}
+
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{schemas: make(map[int]Schema)}
+}
+
+func (r *MemorySchemaRegistry) Register(id int, schemaType SchemaType, definition string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[id] = Schema{ID: id, Type: schemaType, Definition: definition}
+}
+
+func (r *MemorySchemaRegistry) GetSchema(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.schemas[id]
+	if !ok {
+		return Schema{}, fmt.Errorf("schema %v not found", id)
+	}
+	return schema, nil
+}
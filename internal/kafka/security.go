@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismScramSHA256 = "SCRAM-SHA-256"
+	SASLMechanismScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Настройки аутентификации и шифрования соединений с брокерами
+type SecurityConfig struct {
+	SASLMechanism string // пустой — без SASL
+	SASLUsername  string
+	SASLPassword  string
+
+	TLSEnabled            bool
+	TLSCAFile             string // свой CA, иначе системные сертификаты
+	TLSCertFile           string // клиентский сертификат для mTLS
+	TLSKeyFile            string
+	TLSServerName         string // переопределение имени сервера для проверки сертификата
+	TLSInsecureSkipVerify bool
+}
+
+func (s SecurityConfig) validate() []error {
+	var errs []error
+
+	switch strings.ToUpper(s.SASLMechanism) {
+	case "":
+	case SASLMechanismPlain, SASLMechanismScramSHA256, SASLMechanismScramSHA512:
+		if s.SASLUsername == "" || s.SASLPassword == "" {
+			errs = append(errs, fmt.Errorf("kafka sasl mechanism %v requires username and password", s.SASLMechanism))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("kafka sasl mechanism must be one of %v, %v, %v, got %q",
+			SASLMechanismPlain, SASLMechanismScramSHA256, SASLMechanismScramSHA512, s.SASLMechanism))
+	}
+
+	tlsFilesSet := s.TLSCAFile != "" || s.TLSCertFile != "" || s.TLSKeyFile != "" || s.TLSServerName != ""
+	if tlsFilesSet && !s.TLSEnabled {
+		errs = append(errs, errors.New("kafka tls options are set but tls is not enabled"))
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		errs = append(errs, errors.New("kafka tls client certificate and key must be set together"))
+	}
+
+	return errs
+}
+
+func (s SecurityConfig) saslMechanism() (sasl.Mechanism, error) {
+	switch strings.ToUpper(s.SASLMechanism) {
+	case "":
+		return nil, nil
+	case SASLMechanismPlain:
+		return plain.Mechanism{Username: s.SASLUsername, Password: s.SASLPassword}, nil
+	case SASLMechanismScramSHA256:
+		return scram.Mechanism(scram.SHA256, s.SASLUsername, s.SASLPassword)
+	case SASLMechanismScramSHA512:
+		return scram.Mechanism(scram.SHA512, s.SASLUsername, s.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %q", s.SASLMechanism)
+	}
+}
+
+func (s SecurityConfig) tlsConfig() (*tls.Config, error) {
+	if !s.TLSEnabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         s.TLSServerName,
+		InsecureSkipVerify: s.TLSInsecureSkipVerify,
+	}
+
+	if s.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in tls ca file %v", s.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if s.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// Dialer для kafka.Reader
+func (s SecurityConfig) dialer() (*kafka.Dialer, error) {
+	mechanism, err := s.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsCfg,
+	}, nil
+}
+
+// Transport для kafka.Writer
+func (s SecurityConfig) transport() (*kafka.Transport, error) {
+	mechanism, err := s.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		SASL: mechanism,
+		TLS:  tlsCfg,
+	}, nil
+}
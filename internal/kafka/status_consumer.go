@@ -0,0 +1,270 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"l0/internal/cache"
+	"l0/internal/db"
+	"l0/internal/metrics"
+	"l0/internal/model"
+	"l0/internal/tracing"
+	"l0/internal/validation"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Консьюмер событий смены статуса товаров. В отличие от Consumer не требует полного
+// снимка заказа: событие меняет статус одного товара в БД и в кэше
+type StatusConsumer struct {
+	reader        MessageReader
+	store         db.ItemStatusStore
+	cachedOrders  cache.CacheRepository
+	dlq           *DeadLetterQueue
+	topic         string
+	retry         RetryPolicy
+	missingRetry  RetryPolicy // ожидание заказа, которого ещё нет в БД
+	rejectRetry   RetryPolicy // запись в DLQ
+	workers       int
+	batchSize     int
+	batchWait     time.Duration
+	drainTimeout  time.Duration
+	offsets       *offsetTracker
+	maxPending    int
+	duplicates    atomic.Int64
+	staleVersions atomic.Int64
+	metrics       *metrics.ConsumerMetrics
+	logger        *log.Logger
+	val           *validation.Validator
+}
+
+// dlq обязательна: без неё смещение невалидного события нельзя подтвердить
+func NewStatusConsumer(cfg Config, store db.ItemStatusStore, cachedOrders cache.CacheRepository, dlq *DeadLetterQueue, validator *validation.Validator, metrics *metrics.ConsumerMetrics, logger *log.Logger) (*StatusConsumer, error) {
+	if dlq == nil {
+		return nil, errors.New("status consumer requires a dead letter queue")
+	}
+
+	readerCfg, err := cfg.readerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatusConsumer{
+		reader:       kafka.NewReader(readerCfg),
+		store:        store,
+		cachedOrders: cachedOrders,
+		dlq:          dlq,
+		topic:        cfg.Topic,
+		retry:        cfg.Retry,
+		missingRetry: missingItemPolicy(cfg.Retry, cfg.MissingItemWait),
+		rejectRetry:  rejectPolicy(cfg.Retry),
+		workers:      cfg.Workers,
+		batchSize:    cfg.BatchSize,
+		batchWait:    cfg.BatchWait,
+		drainTimeout: cfg.DrainTimeout,
+		offsets:      newOffsetTracker(),
+		maxPending:   cfg.MaxUncommitted,
+		metrics:      metrics,
+		logger:       logger,
+		val:          validator,
+	}, nil
+}
+
+// Заказы и статусы читаются из разных топиков, поэтому событие статуса может прийти
+// раньше заказа. ErrItemNotFound повторяется с отдельным коротким бюджетом wait:
+// пока событие ждёт, воркер не обрабатывает другие события, поэтому ждать
+// минутами, как при временных ошибках БД, нельзя. После бюджета событие уходит в DLQ
+func missingItemPolicy(p RetryPolicy, wait time.Duration) RetryPolicy {
+	p.MaxElapsedTime = wait
+	p.Retryable = func(err error) bool {
+		return errors.Is(err, db.ErrItemNotFound)
+	}
+	return p
+}
+
+// Жизненный цикл тот же, что у Consumer.Start: после отмены ctx полученные
+// события дообрабатываются не дольше DrainTimeout
+func (c *StatusConsumer) Start(ctx context.Context) DrainStatus {
+	c.logger.Printf("Запуск консьюмера статусов (воркеров: %v)...", c.workers)
+
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	// События одного заказа попадают в один воркер и применяются по порядку
+	pool := newWorkerPool(c.workers, c.batchSize, c.batchWait, func(msgs []kafka.Message) {
+		c.handleBatch(workCtx, msgs)
+	})
+
+	go reportReaderStats(ctx, func() MessageReader { return c.reader }, c.metrics)
+	go reportCommitStalls(ctx, c.topic, c.offsets, c.metrics)
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Println("Остановка консьюмера статусов: дообработка полученных событий...")
+			status := drainPool(pool, c.offsets, c.drainTimeout, cancelWork)
+			if !status.Drained {
+				c.logger.Printf("Дообработка событий статуса не уложилась в %v и прервана", c.drainTimeout)
+			}
+			c.logger.Printf("Консьюмер статусов остановлен за %v, неподтверждённых событий: %v", status.Duration, status.Uncommitted)
+			return status
+		default:
+			if !c.offsets.waitBelow(ctx, c.maxPending, c.logBackpressure) {
+				continue
+			}
+			message, err := c.reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					c.logger.Printf("Ошибка чтения события статуса: %v", err)
+				}
+				continue
+			}
+
+			c.metrics.ObserveFetch(message)
+			c.offsets.track(message)
+			c.metrics.ObserveUncommitted(message.Topic, c.offsets.uncommitted())
+			pool.dispatch(ctx, message)
+		}
+	}
+}
+
+func (c *StatusConsumer) logBackpressure(uncommitted int) {
+	c.logger.Printf("Неподтверждённых событий статуса: %v, чтение приостановлено до подтверждения смещений", uncommitted)
+}
+
+// События обрабатываются по одному: каждое — короткий UPDATE одной строки
+func (c *StatusConsumer) handleBatch(ctx context.Context, msgs []kafka.Message) {
+	started := time.Now()
+	done := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if c.processMessage(ctx, msg) {
+			done = append(done, msg)
+		}
+	}
+
+	if err := c.offsets.commit(ctx, c.reader, done...); err != nil {
+		c.metrics.Failed(msgs[0].Topic, metrics.FailureCommit)
+		c.logger.Printf("Ошибка подтверждения событий статуса: %v", err)
+	}
+	c.metrics.ObserveUncommitted(msgs[0].Topic, c.offsets.uncommitted())
+	observeHandled(c.metrics, started, msgs, done)
+}
+
+// Обработка события. Возвращает true, если смещение можно подтверждать:
+// статус применён, пропущен как повтор или устаревший либо событие отправлено в DLQ
+func (c *StatusConsumer) processMessage(ctx context.Context, msg kafka.Message) bool {
+	ctx, span := startMessageSpan(ctx, msg)
+	defer span.End()
+
+	event, class, err := c.decodeEvent(msg)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return c.reject(ctx, msg, class, err, 1)
+	}
+
+	updateCtx, updateSpan := startSpan(ctx, "update item status",
+		attribute.String("order.uid", event.OrderUID),
+		attribute.Int("item.chrt_id", event.ChrtID),
+	)
+	attempts := 0
+	_, err = c.missingRetry.Do(updateCtx, func() error {
+		n, err := c.retry.Do(updateCtx, func() error {
+			return c.store.UpdateItemStatus(updateCtx, event, messageRef(msg))
+		}, func(attempt int, err error, wait time.Duration) {
+			c.logger.Printf("Временная ошибка обновления статуса товара %v заказа %v (попытка %v), повтор через %v: %v",
+				event.ChrtID, event.OrderUID, attempt, wait, err)
+		})
+		attempts += n
+		return err
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Товар %v заказа %v ещё не сохранён (попытка %v), повтор через %v",
+			event.ChrtID, event.OrderUID, attempt, wait)
+	})
+	endSaveSpan(updateSpan, attempts, err)
+	switch {
+	case errors.Is(err, db.ErrDuplicate):
+		c.duplicates.Add(1)
+		c.metrics.Processed(msg.Topic, metrics.ResultDuplicate)
+		c.logger.Printf("Событие статуса partition=%v offset=%v уже обработано, пропускаем", msg.Partition, msg.Offset)
+		return true
+	case errors.Is(err, db.ErrStale):
+		c.staleVersions.Add(1)
+		c.metrics.Processed(msg.Topic, metrics.ResultStale)
+		c.logger.Printf("Событие статуса товара %v заказа %v от %v устарело, пропускаем",
+			event.ChrtID, event.OrderUID, event.ChangedAt)
+		return true
+	case err != nil:
+		if ctx.Err() != nil {
+			return false
+		}
+		c.logger.Printf("Ошибка обновления статуса товара %v заказа %v: %v", event.ChrtID, event.OrderUID, err)
+		return c.reject(ctx, msg, ErrorClassPersist, err, attempts)
+	}
+
+	// В кэше статус меняется, только если заказ там есть; иначе он загрузится из БД уже новым
+	_, cacheSpan := startSpan(ctx, "cache update", attribute.String("order.uid", event.OrderUID))
+	c.cachedOrders.UpdateItemStatus(event.OrderUID, event.ChrtID, event.RID, event.Status)
+	cacheSpan.End()
+	c.metrics.Processed(msg.Topic, metrics.ResultUpdated)
+
+	c.logger.Printf("Статус товара %v заказа %v изменён на %v", event.ChrtID, event.OrderUID, event.Status)
+	return true
+}
+
+// Десериализация и валидация события. При ошибке возвращает её класс
+func (c *StatusConsumer) decodeEvent(msg kafka.Message) (model.ItemStatusEvent, ErrorClass, error) {
+	var event model.ItemStatusEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		c.logger.Printf("Ошибка десериализации события статуса: %v. Сообщение: %v", err, string(msg.Value))
+		return event, ErrorClassDecode, err
+	}
+
+	// Ключ сообщения задаёт порядок обработки, поэтому он обязан совпадать с заказом из тела
+	if len(msg.Key) > 0 && string(msg.Key) != event.OrderUID {
+		return event, ErrorClassValidate, fmt.Errorf("message key %q does not match order_uid %q", msg.Key, event.OrderUID)
+	}
+
+	if c.val != nil {
+		if err := c.val.Struct(event); err != nil {
+			logValidationErrors(c.logger, "Ошибка валидации события статуса", err)
+			return event, ErrorClassValidate, err
+		}
+	}
+
+	return event, "", nil
+}
+
+// Отправка необработанного события в DLQ. Пока DLQ недоступна, отправка повторяется
+// по rejectRetry. false — ctx отменён раньше, и смещение не подтверждается
+func (c *StatusConsumer) reject(ctx context.Context, msg kafka.Message, class ErrorClass, cause error, attempts int) bool {
+	c.metrics.Failed(msg.Topic, string(class))
+
+	_, err := c.rejectRetry.Do(ctx, func() error {
+		return c.dlq.Publish(ctx, msg, class, cause, attempts)
+	}, func(attempt int, err error, wait time.Duration) {
+		c.logger.Printf("Ошибка отправки события статуса offset=%v в DLQ (попытка %v), повтор через %v: %v",
+			msg.Offset, attempt, wait, err)
+	})
+	if err != nil {
+		return false
+	}
+
+	c.metrics.Processed(msg.Topic, metrics.ResultRejected)
+	return true
+}
+
+func (c *StatusConsumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Duplicates:    c.duplicates.Load(),
+		StaleVersions: c.staleVersions.Load(),
+	}
+}
+
+func (c *StatusConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,236 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"l0/internal/cache"
+	"l0/internal/db"
+	"l0/internal/model"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type MockItemStatusStore struct {
+	updateFn func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error
+}
+
+func (m *MockItemStatusStore) UpdateItemStatus(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+	if m.updateFn != nil {
+		return m.updateFn(ctx, event, refs...)
+	}
+	return nil
+}
+
+func newTestStatusConsumer(store *MockItemStatusStore, writer *MockMessageWriter) (*StatusConsumer, *MockMessageReader, *cache.Cache) {
+	logger := log.New(io.Discard, "", 0)
+	reader := &MockMessageReader{}
+	cached := cache.NewCache(10)
+	return &StatusConsumer{
+		reader:       reader,
+		store:        store,
+		cachedOrders: cached,
+		dlq:          NewDeadLetterQueueWithWriter(writer, "order-status.dlq", logger),
+		retry:        newTestRetryPolicy(),
+		missingRetry: missingItemPolicy(newTestRetryPolicy(), time.Second),
+		rejectRetry:  rejectPolicy(newTestRetryPolicy()),
+		workers:      1,
+		offsets:      newOffsetTracker(),
+		logger:       logger,
+		val:          newTestValidator(),
+	}, reader, cached
+}
+
+func newStatusMessage(t *testing.T, event model.ItemStatusEvent) kafka.Message {
+	value, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+	return kafka.Message{Topic: "order-status", Partition: 0, Offset: 7, Key: []byte(event.OrderUID), Value: value}
+}
+
+func handleStatus(c *StatusConsumer, msg kafka.Message) {
+	c.offsets.track(msg)
+	c.handleBatch(context.Background(), []kafka.Message{msg})
+}
+
+func TestStatusConsumer_UpdatesStoreAndCache(t *testing.T) {
+	var updated model.ItemStatusEvent
+	store := &MockItemStatusStore{
+		updateFn: func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+			updated = event
+			return nil
+		},
+	}
+	c, reader, cached := newTestStatusConsumer(store, &MockMessageWriter{})
+	cached.SetOrder(model.Order{OrderUID: "order-1", Items: []model.Item{{ChrtID: 11, Status: 200}}})
+
+	event := model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, Status: 300, ChangedAt: time.Now()}
+	handleStatus(c, newStatusMessage(t, event))
+
+	if updated.OrderUID != "order-1" || updated.ChrtID != 11 || updated.Status != 300 {
+		t.Errorf("Unexpected event passed to store: %+v", updated)
+	}
+	order, _ := cached.GetOrder("order-1")
+	if order.Items[0].Status != 300 {
+		t.Errorf("Expected cached status 300, got %v", order.Items[0].Status)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed, got %v commits", len(reader.committed))
+	}
+}
+
+func TestStatusConsumer_UpdatesOnlyLineWithRID(t *testing.T) {
+	c, _, cached := newTestStatusConsumer(&MockItemStatusStore{}, &MockMessageWriter{})
+	cached.SetOrder(model.Order{OrderUID: "order-1", Items: []model.Item{
+		{ChrtID: 11, RID: "rid-1", Status: 200},
+		{ChrtID: 11, RID: "rid-2", Status: 200},
+	}})
+
+	event := model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, RID: "rid-2", Status: 300, ChangedAt: time.Now()}
+	handleStatus(c, newStatusMessage(t, event))
+
+	order, _ := cached.GetOrder("order-1")
+	if order.Items[0].Status != 200 || order.Items[1].Status != 300 {
+		t.Errorf("Expected only line rid-2 to change, got statuses %v and %v", order.Items[0].Status, order.Items[1].Status)
+	}
+}
+
+func TestStatusConsumer_InvalidEventGoesToDLQ(t *testing.T) {
+	store := &MockItemStatusStore{
+		updateFn: func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+			t.Error("Invalid event must not reach the store")
+			return nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, _ := newTestStatusConsumer(store, writer)
+
+	// Нет chrt_id и времени изменения
+	handleStatus(c, newStatusMessage(t, model.ItemStatusEvent{OrderUID: "order-1", Status: 300}))
+
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 message in DLQ, got %v", len(writer.written))
+	}
+	if class := headerValue(writer.written[0], HeaderErrorClass); class != string(ErrorClassValidate) {
+		t.Errorf("Expected error class %v, got %v", ErrorClassValidate, class)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed after DLQ, got %v commits", len(reader.committed))
+	}
+}
+
+func TestStatusConsumer_KeyMismatchGoesToDLQ(t *testing.T) {
+	writer := &MockMessageWriter{}
+	c, _, _ := newTestStatusConsumer(&MockItemStatusStore{}, writer)
+
+	msg := newStatusMessage(t, model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, Status: 300, ChangedAt: time.Now()})
+	msg.Key = []byte("order-2")
+	handleStatus(c, msg)
+
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 message in DLQ, got %v", len(writer.written))
+	}
+}
+
+func TestStatusConsumer_RetriesDLQUntilPublished(t *testing.T) {
+	calls := 0
+	writer := &MockMessageWriter{
+		writeFn: func(ctx context.Context, msgs ...kafka.Message) error {
+			calls++
+			if calls < 3 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		},
+	}
+	c, reader, _ := newTestStatusConsumer(&MockItemStatusStore{}, writer)
+
+	handleStatus(c, kafka.Message{Value: []byte("{broken")})
+
+	if calls != 3 {
+		t.Errorf("Expected 3 DLQ publish attempts, got %v", calls)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed once DLQ publish succeeds, got %v commits", len(reader.committed))
+	}
+}
+
+func TestStatusConsumer_UnknownItemGoesToDLQ(t *testing.T) {
+	store := &MockItemStatusStore{
+		updateFn: func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+			return db.ErrItemNotFound
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, _, _ := newTestStatusConsumer(store, writer)
+	c.missingRetry.MaxElapsedTime = 20 * time.Millisecond
+
+	handleStatus(c, newStatusMessage(t, model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, Status: 300, ChangedAt: time.Now()}))
+
+	if len(writer.written) != 1 {
+		t.Fatalf("Expected 1 message in DLQ, got %v", len(writer.written))
+	}
+	if class := headerValue(writer.written[0], HeaderErrorClass); class != string(ErrorClassPersist) {
+		t.Errorf("Expected error class %v, got %v", ErrorClassPersist, class)
+	}
+}
+
+func TestStatusConsumer_RetriesItemNotYetSaved(t *testing.T) {
+	calls := 0
+	store := &MockItemStatusStore{
+		updateFn: func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+			calls++
+			if calls <= 2 {
+				// Заказ ещё не дошёл из топика заказов
+				return db.ErrItemNotFound
+			}
+			return nil
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, _ := newTestStatusConsumer(store, writer)
+
+	handleStatus(c, newStatusMessage(t, model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, Status: 300, ChangedAt: time.Now()}))
+
+	if calls != 3 {
+		t.Errorf("Expected 3 update attempts, got %v", calls)
+	}
+	if len(writer.written) != 0 {
+		t.Errorf("Expected no messages in DLQ, got %v", len(writer.written))
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed, got %v commits", len(reader.committed))
+	}
+}
+
+func TestStatusConsumer_StaleEventDoesNotTouchCache(t *testing.T) {
+	store := &MockItemStatusStore{
+		updateFn: func(ctx context.Context, event model.ItemStatusEvent, refs ...db.MessageRef) error {
+			return db.ErrStale
+		},
+	}
+	writer := &MockMessageWriter{}
+	c, reader, cached := newTestStatusConsumer(store, writer)
+	cached.SetOrder(model.Order{OrderUID: "order-1", Items: []model.Item{{ChrtID: 11, Status: 200}}})
+
+	handleStatus(c, newStatusMessage(t, model.ItemStatusEvent{OrderUID: "order-1", ChrtID: 11, Status: 300, ChangedAt: time.Now()}))
+
+	order, _ := cached.GetOrder("order-1")
+	if order.Items[0].Status != 200 {
+		t.Errorf("Stale event must not change cached status, got %v", order.Items[0].Status)
+	}
+	if len(writer.written) != 0 {
+		t.Errorf("Stale event must not go to DLQ")
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected offset to be committed, got %v commits", len(reader.committed))
+	}
+	if stats := c.Stats(); stats.StaleVersions != 1 {
+		t.Errorf("Expected 1 stale event, got %v", stats.StaleVersions)
+	}
+}
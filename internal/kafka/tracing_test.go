@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+	"l0/internal/db"
+	"l0/internal/model"
+	"l0/internal/tracing"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func spansByName(spans tracetest.SpanStubs) map[string]tracetest.SpanStub {
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	return byName
+}
+
+func TestConsumer_ProcessMessage_ContinuesTraceFromHeaders(t *testing.T) {
+	exporter, restore := tracing.InstallInMemory()
+	defer restore()
+
+	var repoInTrace bool
+	store := &MockOrderStore{
+		saveOrderFn: func(ctx context.Context, ord model.Order, refs ...db.MessageRef) error {
+			repoInTrace = trace.SpanContextFromContext(ctx).TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736"
+			return nil
+		},
+	}
+	c, _, _ := newTestConsumer(store, &MockMessageWriter{})
+
+	msg := newTestMessage(t, "order-1")
+	msg.Headers = []kafka.Header{{Key: "traceparent", Value: []byte(testTraceParent)}}
+	handle(c, msg)
+
+	spans := spansByName(exporter.GetSpans())
+	process, ok := spans["orders process"]
+	if !ok {
+		t.Fatalf("Expected process span, got %v", exporter.GetSpans())
+	}
+	if process.Parent.SpanID().String() != "00f067aa0ba902b7" || !process.Parent.IsRemote() {
+		t.Errorf("Process span should continue the producer's trace, parent %v", process.Parent)
+	}
+	for _, name := range []string{"decode", "save", "cache update"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected %q span", name)
+			continue
+		}
+		if span.Parent.SpanID() != process.SpanContext.SpanID() {
+			t.Errorf("Span %q should be a child of the process span", name)
+		}
+	}
+	if !repoInTrace {
+		t.Error("Repository should receive the trace context")
+	}
+}
+
+func TestConsumer_ProcessMessage_RecordsDecodeErrorInSpan(t *testing.T) {
+	exporter, restore := tracing.InstallInMemory()
+	defer restore()
+
+	c, _, _ := newTestConsumer(&MockOrderStore{}, &MockMessageWriter{})
+	handle(c, kafka.Message{Topic: "orders", Value: []byte("garbage")})
+
+	spans := spansByName(exporter.GetSpans())
+	for _, name := range []string{"orders process", "decode"} {
+		if spans[name].Status.Code != codes.Error {
+			t.Errorf("Span %q should have error status, got %v", name, spans[name].Status)
+		}
+	}
+	if _, ok := spans["save"]; ok {
+		t.Error("Undecodable message must not be saved")
+	}
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	headers := []kafka.Header{{Key: "Traceparent", Value: []byte("a")}}
+	carrier := headerCarrier{headers: &headers}
+
+	if got := carrier.Get("traceparent"); got != "a" {
+		t.Errorf("Get should ignore header case, got %q", got)
+	}
+	carrier.Set("traceparent", "b")
+	carrier.Set("tracestate", "c")
+	if len(headers) != 2 || carrier.Get("traceparent") != "b" || carrier.Get("tracestate") != "c" {
+		t.Errorf("Unexpected headers after Set: %+v", headers)
+	}
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+)
+
+const namespace = "order_service"
+
+// Результаты обработки сообщения для счётчика processed
+const (
+	ResultSaved     = "saved"
+	ResultDuplicate = "duplicate"
+	ResultStale     = "stale"
+	ResultDeleted   = "deleted"
+	ResultUpdated   = "updated"
+	ResultRejected  = "rejected" // отправлено в DLQ или карантин
+)
+
+// Класс сбоя подтверждения смещений; остальные классы совпадают с классами DLQ
+const FailureCommit = "commit"
+
+// Registry — реестр метрик сервиса и обработчик /metrics для него
+type Registry struct {
+	registry   *prometheus.Registry
+	Consumer   *ConsumerMetrics
+	Validation *ValidationMetrics
+}
+
+func New() *Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return &Registry{
+		registry:   reg,
+		Consumer:   NewConsumerMetrics(reg),
+		Validation: NewValidationMetrics(reg),
+	}
+}
+
+// Регистрация дополнительных метрик других пакетов
+func (r *Registry) MustRegister(cs ...prometheus.Collector) {
+	r.registry.MustRegister(cs...)
+}
+
+// Метрики в текстовом формате Prometheus
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// Метрики консьюмеров Kafka. Все методы безопасны для nil, чтобы консьюмер
+// работал и без метрик (например, в тестах)
+type ConsumerMetrics struct {
+	processed *prometheus.CounterVec
+	failed    *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	age       *prometheus.HistogramVec
+	lag       *prometheus.GaugeVec
+	pending   *prometheus.GaugeVec
+	stalled   *prometheus.GaugeVec
+
+	fetched    *prometheus.CounterVec
+	bytes      *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	rebalances *prometheus.CounterVec
+}
+
+func NewConsumerMetrics(reg prometheus.Registerer) *ConsumerMetrics {
+	m := &ConsumerMetrics{
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "messages_processed_total",
+			Help:      "Обработанные сообщения по результату: saved, duplicate, stale, deleted, updated, rejected.",
+		}, []string{"topic", "result"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "messages_failed_total",
+			Help:      "Сбои обработки по классу: decode, validate, persist, commit.",
+		}, []string{"topic", "class"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "processing_duration_seconds",
+			Help:      "Время обработки пачки сообщений воркером, включая повторы и запись в БД.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"topic"}),
+		age: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "message_age_seconds",
+			Help:      "Время от записи сообщения в Kafka до окончания его обработки.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+		}, []string{"topic"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "lag",
+			Help:      "Число сообщений партиции, ещё не прочитанных консьюмером.",
+		}, []string{"topic", "partition"}),
+		pending: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "uncommitted_messages",
+			Help:      "Полученные сообщения, смещения которых ещё не подтверждены. При достижении KAFKA_MAX_UNCOMMITTED чтение приостанавливается.",
+		}, []string{"topic"}),
+		stalled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "commit_stalled_seconds",
+			Help:      "Сколько смещение партиции не сдвигается, хотя есть неподтверждённые сообщения; 0 — партиция не стоит. Долгий рост означает, что сообщение застряло в обработке.",
+		}, []string{"topic", "partition"}),
+		fetched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "messages_total",
+			Help:      "Сообщения, полученные kafka.Reader.",
+		}, []string{"topic"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "bytes_total",
+			Help:      "Объём сообщений, полученных kafka.Reader.",
+		}, []string{"topic"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "errors_total",
+			Help:      "Ошибки kafka.Reader при работе с брокером.",
+		}, []string{"topic"}),
+		rebalances: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "rebalances_total",
+			Help:      "Перебалансировки группы консьюмеров.",
+		}, []string{"topic"}),
+	}
+
+	reg.MustRegister(m.processed, m.failed, m.duration, m.age, m.lag, m.pending, m.stalled,
+		m.fetched, m.bytes, m.errors, m.rebalances)
+	return m
+}
+
+func (m *ConsumerMetrics) Processed(topic, result string) {
+	if m == nil {
+		return
+	}
+	m.processed.WithLabelValues(topic, result).Inc()
+}
+
+func (m *ConsumerMetrics) Failed(topic, class string) {
+	if m == nil {
+		return
+	}
+	m.failed.WithLabelValues(topic, class).Inc()
+}
+
+func (m *ConsumerMetrics) ObserveBatch(topic string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(topic).Observe(duration.Seconds())
+}
+
+// Возраст сообщения по его времени в Kafka. Сообщения без времени пропускаются
+func (m *ConsumerMetrics) ObserveMessage(msg kafka.Message) {
+	if m == nil || msg.Time.IsZero() {
+		return
+	}
+	m.age.WithLabelValues(msg.Topic).Observe(time.Since(msg.Time).Seconds())
+}
+
+// Отставание партиции по только что полученному сообщению: HighWaterMark —
+// смещение, следующее за последним записанным в партицию
+func (m *ConsumerMetrics) ObserveFetch(msg kafka.Message) {
+	if m == nil || msg.HighWaterMark == 0 {
+		return
+	}
+	lag := msg.HighWaterMark - msg.Offset - 1
+	m.lag.WithLabelValues(msg.Topic, strconv.Itoa(msg.Partition)).Set(float64(max(lag, 0)))
+}
+
+// Число полученных, но ещё не подтверждённых сообщений консьюмера
+func (m *ConsumerMetrics) ObserveUncommitted(topic string, n int) {
+	if m == nil {
+		return
+	}
+	m.pending.WithLabelValues(topic).Set(float64(n))
+}
+
+// Сколько смещение партиции стоит на месте при неподтверждённых сообщениях
+func (m *ConsumerMetrics) ObserveCommitStall(topic string, partition int, stalled time.Duration) {
+	if m == nil {
+		return
+	}
+	m.stalled.WithLabelValues(topic, strconv.Itoa(partition)).Set(stalled.Seconds())
+}
+
+// Учёт статистики kafka.Reader. Reader.Stats() возвращает счётчики с момента
+// предыдущего вызова, поэтому они прибавляются, а отставание перезаписывается
+func (m *ConsumerMetrics) ObserveReaderStats(stats kafka.ReaderStats) {
+	if m == nil {
+		return
+	}
+	m.fetched.WithLabelValues(stats.Topic).Add(float64(stats.Messages))
+	m.bytes.WithLabelValues(stats.Topic).Add(float64(stats.Bytes))
+	m.errors.WithLabelValues(stats.Topic).Add(float64(stats.Errors))
+	m.rebalances.WithLabelValues(stats.Topic).Add(float64(stats.Rebalances))
+	if stats.Partition != "" && stats.Lag >= 0 {
+		m.lag.WithLabelValues(stats.Topic, stats.Partition).Set(float64(stats.Lag))
+	}
+}
+
+// Метрики валидации входящих данных. Безопасны для nil
+type ValidationMetrics struct {
+	failures *prometheus.CounterVec
+}
+
+func NewValidationMetrics(reg prometheus.Registerer) *ValidationMetrics {
+	m := &ValidationMetrics{
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "validation",
+			Name:      "failures_total",
+			Help:      "Нарушения правил валидации по полю (путь без индексов, например items[].price) и правилу.",
+		}, []string{"field", "rule"}),
+	}
+
+	reg.MustRegister(m.failures)
+	return m
+}
+
+func (m *ValidationMetrics) Failed(field, rule string) {
+	if m == nil {
+		return
+	}
+	m.failures.WithLabelValues(field, rule).Inc()
+}
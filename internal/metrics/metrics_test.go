@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestConsumerMetrics_NilIsNoop(t *testing.T) {
+	var m *ConsumerMetrics
+	m.Processed("orders", ResultSaved)
+	m.Failed("orders", "decode")
+	m.ObserveBatch("orders", time.Second)
+	m.ObserveMessage(kafka.Message{Topic: "orders", Time: time.Now()})
+	m.ObserveFetch(kafka.Message{Topic: "orders", HighWaterMark: 10})
+	m.ObserveReaderStats(kafka.ReaderStats{Topic: "orders"})
+	m.ObserveUncommitted("orders", 3)
+	m.ObserveCommitStall("orders", 0, time.Minute)
+
+	var v *ValidationMetrics
+	v.Failed("items[].price", "gte")
+}
+
+func TestConsumerMetrics_CountsByClass(t *testing.T) {
+	m := NewConsumerMetrics(prometheus.NewRegistry())
+
+	m.Failed("orders", "validate")
+	m.Failed("orders", "validate")
+	m.Failed("orders", FailureCommit)
+	m.Processed("orders", ResultSaved)
+
+	if got := testutil.ToFloat64(m.failed.WithLabelValues("orders", "validate")); got != 2 {
+		t.Errorf("Expected 2 validate failures, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.failed.WithLabelValues("orders", FailureCommit)); got != 1 {
+		t.Errorf("Expected 1 commit failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.processed.WithLabelValues("orders", ResultSaved)); got != 1 {
+		t.Errorf("Expected 1 saved message, got %v", got)
+	}
+}
+
+func TestConsumerMetrics_Lag(t *testing.T) {
+	m := NewConsumerMetrics(prometheus.NewRegistry())
+
+	// Прочитано сообщение 41, в партиции последнее — 99
+	m.ObserveFetch(kafka.Message{Topic: "orders", Partition: 3, Offset: 41, HighWaterMark: 100})
+	if got := testutil.ToFloat64(m.lag.WithLabelValues("orders", "3")); got != 58 {
+		t.Errorf("Expected lag 58, got %v", got)
+	}
+
+	// Статистика reader перезаписывает отставание и прибавляет счётчики
+	m.ObserveReaderStats(kafka.ReaderStats{Topic: "orders", Partition: "3", Lag: 5, Messages: 7})
+	m.ObserveReaderStats(kafka.ReaderStats{Topic: "orders", Partition: "3", Lag: 2, Messages: 3})
+	if got := testutil.ToFloat64(m.lag.WithLabelValues("orders", "3")); got != 2 {
+		t.Errorf("Expected lag 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.fetched.WithLabelValues("orders")); got != 10 {
+		t.Errorf("Expected 10 fetched messages, got %v", got)
+	}
+}
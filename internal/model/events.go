@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Событие order.accepted: заказ надёжно сохранён сервисом
+type OrderAccepted struct {
+	OrderUID    string    `json:"order_uid"`
+	TrackNumber string    `json:"track_number"`
+	CustomerID  string    `json:"customer_id"`
+	Version     int64     `json:"version"`
+	DateCreated time.Time `json:"date_created"`
+	AcceptedAt  time.Time `json:"accepted_at"`
+}
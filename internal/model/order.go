@@ -14,9 +14,10 @@ type Order struct {
 	SMID              int       `json:"sm_id" validate:"required,gte=0"`
 	DateCreated       time.Time `json:"date_created" validate:"required"`
 	OofShard          string    `json:"oof_shard" validate:"required"`
-	Delivery          Delivery  `json:"delivery" validate:"required,dive"`
-	Payment           Payment   `json:"payment" validate:"required,dive"`
-	Items             []Item    `json:"items" validate:"required,dive,min=1"`
+	Version           int64     `json:"version,omitempty"` // версия события, более старые не перезаписывают заказ
+	Delivery          Delivery  `json:"delivery" validate:"required"`
+	Payment           Payment   `json:"payment" validate:"required"`
+	Items             []Item    `json:"items" validate:"required,min=1,dive"`
 }
 
 type Delivery struct {
@@ -32,7 +33,7 @@ type Delivery struct {
 type Payment struct {
 	Transaction  string  `json:"transaction" validate:"required"`
 	RequestID    string  `json:"request_id" validate:"required"`
-	Currency     string  `json:"currency" validate:"required,in=USD,RUB,EUR"`
+	Currency     string  `json:"currency" validate:"required,oneof=USD RUB EUR"`
 	Provider     string  `json:"provider" validate:"required"`
 	Amount       float64 `json:"amount" validate:"required,gte=0"`
 	PaymentDT    int64   `json:"payment_dt" validate:"required,gte=0"`
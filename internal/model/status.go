@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Событие смены статуса товара в заказе (топик order-status)
+type ItemStatusEvent struct {
+	OrderUID  string    `json:"order_uid" validate:"required"`
+	ChrtID    int       `json:"chrt_id" validate:"required,gte=0"`
+	RID       string    `json:"rid,omitempty"` // строка заказа, если товар встречается в нём несколько раз
+	Status    int       `json:"status" validate:"gte=0"`
+	ChangedAt time.Time `json:"changed_at" validate:"required"`
+}
@@ -0,0 +1,146 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"l0/internal/metrics"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	ruTranslations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+// Поддерживаемые языки сообщений об ошибках
+const (
+	LocaleRU = "ru"
+	LocaleEN = "en"
+)
+
+// Ошибка одного поля
+type FieldError struct {
+	Field   string `json:"field"`           // путь в JSON, например items[2].price
+	Rule    string `json:"rule"`            // нарушенное правило: required, gte, oneof, ...
+	Param   string `json:"param,omitempty"` // параметр правила: 0 для gte=0
+	Value   any    `json:"value,omitempty"` // значение поля; для вложенных структур и списков не заполняется
+	Message string `json:"message"`         // описание на языке валидатора
+}
+
+// Errors — все ошибки валидации одного значения
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		rule := fe.Rule
+		if fe.Param != "" {
+			rule += "=" + fe.Param
+		}
+		parts[i] = fmt.Sprintf("%v failed on '%v'", fe.Field, rule)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Validator проверяет структуры по тегам validate и описывает каждое нарушение
+// отдельно, с путём в JSON и переводом сообщения. Один экземпляр используется
+// консьюмерами и HTTP-обработчиками; безопасен для конкурентного использования
+type Validator struct {
+	validate *validator.Validate
+	trans    ut.Translator
+	metrics  *metrics.ValidationMetrics
+}
+
+// metrics может быть nil
+func New(locale string, m *metrics.ValidationMetrics) (*Validator, error) {
+	validate := validator.New()
+	// Имена полей берутся из тегов json, чтобы пути совпадали с телом сообщения
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	uni := ut.New(en.New(), en.New(), ru.New())
+	trans, ok := uni.GetTranslator(locale)
+	if !ok {
+		return nil, fmt.Errorf("validation locale must be one of %v, %v, got %q", LocaleRU, LocaleEN, locale)
+	}
+
+	var err error
+	switch locale {
+	case LocaleRU:
+		err = ruTranslations.RegisterDefaultTranslations(validate, trans)
+	case LocaleEN:
+		err = enTranslations.RegisterDefaultTranslations(validate, trans)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to register %v validation translations: %w", locale, err)
+	}
+
+	return &Validator{validate: validate, trans: trans, metrics: m}, nil
+}
+
+// Проверка структуры. Нарушения правил возвращаются как Errors; другие ошибки
+// (например, передана не структура) — как есть
+func (v *Validator) Struct(s any) error {
+	err := v.validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return fmt.Errorf("failed to validate %T: %w", s, err)
+	}
+
+	result := make(Errors, len(validationErrors))
+	for i, e := range validationErrors {
+		result[i] = FieldError{
+			Field:   jsonPath(e.Namespace()),
+			Rule:    e.Tag(),
+			Param:   e.Param(),
+			Value:   scalarValue(e.Value()),
+			Message: e.Translate(v.trans),
+		}
+		v.metrics.Failed(indexPattern.ReplaceAllString(result[i].Field, "[]"), e.Tag())
+	}
+	return result
+}
+
+var indexPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+// Namespace начинается с имени типа проверяемой структуры (Order.items[2].price),
+// в пути JSON оно не нужно
+func jsonPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+// Значение поля для отчёта: только простые типы, чтобы не выводить вложенные структуры целиком
+func scalarValue(value any) any {
+	if value == nil {
+		return nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return value
+	default:
+		return nil
+	}
+}
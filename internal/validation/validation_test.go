@@ -0,0 +1,111 @@
+package validation
+
+import (
+	"errors"
+	"l0/internal/metrics"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testItem struct {
+	Price float64 `json:"price" validate:"required,gte=0"`
+	Name  string  `json:"name" validate:"required"`
+}
+
+type testOrder struct {
+	OrderUID string     `json:"order_uid" validate:"required"`
+	Currency string     `json:"currency" validate:"oneof=USD RUB EUR"`
+	Items    []testItem `json:"items" validate:"required,min=1,dive"`
+}
+
+func TestValidator_Struct_ReportsJSONPaths(t *testing.T) {
+	v, err := New(LocaleEN, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	err = v.Struct(testOrder{
+		OrderUID: "o-1",
+		Currency: "GBP",
+		Items:    []testItem{{Price: 1, Name: "a"}, {Price: 2, Name: "b"}, {Price: -5, Name: "c"}},
+	})
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation Errors, got %T: %v", err, err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 field errors, got %+v", errs)
+	}
+
+	currency := errs[0]
+	if currency.Field != "currency" || currency.Rule != "oneof" || currency.Param != "USD RUB EUR" || currency.Value != "GBP" {
+		t.Errorf("Unexpected currency error: %+v", currency)
+	}
+	price := errs[1]
+	if price.Field != "items[2].price" || price.Rule != "gte" || price.Param != "0" || price.Value != -5.0 {
+		t.Errorf("Unexpected price error: %+v", price)
+	}
+	if !strings.Contains(price.Message, "price must be 0 or greater") {
+		t.Errorf("Expected English message, got %q", price.Message)
+	}
+	if !strings.Contains(err.Error(), "items[2].price failed on 'gte=0'") {
+		t.Errorf("Unexpected error text: %v", err)
+	}
+}
+
+func TestValidator_Struct_TranslatesToRussian(t *testing.T) {
+	v, err := New(LocaleRU, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var errs Errors
+	if !errors.As(v.Struct(testOrder{Currency: "RUB", Items: []testItem{{Price: 1, Name: "a"}}}), &errs) {
+		t.Fatal("Expected validation Errors")
+	}
+	if errs[0].Field != "order_uid" || errs[0].Message != "order_uid обязательное поле" {
+		t.Errorf("Unexpected error: %+v", errs[0])
+	}
+}
+
+func TestValidator_Struct_InvalidInputIsNotPanic(t *testing.T) {
+	v, err := New(LocaleEN, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	err = v.Struct("not a struct")
+	var errs Errors
+	if err == nil || errors.As(err, &errs) {
+		t.Errorf("Expected plain error for non-struct input, got %v", err)
+	}
+}
+
+func TestValidator_Struct_CountsRules(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.NewValidationMetrics(reg)
+	v, err := New(LocaleEN, m)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	v.Struct(testOrder{OrderUID: "o-1", Currency: "RUB", Items: []testItem{{Price: -1, Name: "a"}, {Price: -2, Name: "b"}}})
+
+	expected := `
+		# HELP order_service_validation_failures_total Нарушения правил валидации по полю (путь без индексов, например items[].price) и правилу.
+		# TYPE order_service_validation_failures_total counter
+		order_service_validation_failures_total{field="items[].price",rule="gte"} 2
+	`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNew_UnknownLocale(t *testing.T) {
+	if _, err := New("de", nil); err == nil {
+		t.Error("Expected error for unsupported locale")
+	}
+}
@@ -9,15 +9,18 @@ import (
 	"l0/internal/db"
 	"l0/internal/http"
 	"l0/internal/kafka"
+	"l0/internal/metrics"
+	"l0/internal/tracing"
+	"l0/internal/validation"
 	"log"
+	nethttp "net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	//"github.com/go-playground/validator"
-	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 )
 
@@ -51,38 +54,102 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+// Получает переменную окружения как логическое значение
+func getEnvAsBool(key string, defaultValue bool) bool {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(strValue)
+	if err != nil {
+		log.Fatalf("Неверный формат %v: %v", key, strValue)
+	}
+	return value
+}
+
+// Получает переменную окружения как длительность (например, 500ms, 2m)
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(strValue)
+	if err != nil {
+		log.Fatalf("Неверный формат %v: %v", key, strValue)
+	}
+	return value
+}
+
 func main() {
 	// Загружаем .env только в локальной среде
 	if err := godotenv.Load(); err != nil {
 		log.Println("Локальный .env файл не найден, используем системные переменные")
 	}
 
+	// Подкоманды
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "admin":
+			os.Exit(runAdmin(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "produce":
+			os.Exit(runProduce(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		}
+	}
+
 	// Получаем параметры из окружения с проверкой
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnvAsInt("DB_PORT", 5432)
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPass := getRequiredEnv("DB_PASS") // Обязательный параметр
-	dbName := getEnv("DB_NAME", "wbl0")
-	kafkaBrokers := getEnv("KAFKA_BROKERS", "localhost:9092")
+	connString := loadConnString()
+	kafkaConfig := loadKafkaConfig()
+	statusConfig := loadStatusConfig(kafkaConfig)
+	outboxConfig := loadOutboxConfig()
 	httpPort := getEnvAsInt("HTTP_PORT", 8081)
 	cacheSize := getEnvAsInt("CACHE_SIZE", 10)
+	adminToken := getEnv("ADMIN_TOKEN", "")
 
 	flag.Parse()
-	var ErrServerClosed = errors.New("http: Server closed")
 	// Настройка логгера
 	logger := log.New(os.Stdout, "ORDER-SERVICE: ", log.Ldate|log.Ltime|log.Lshortfile)
 
-	// Подключение к БД
-	connString := buildConnString(dbHost, dbPort, dbUser, dbPass, dbName)
 	ctx := context.Background()
 
+	// Трассировка: контекст из заголовков Kafka продолжается в спанах обработки и запросов к БД
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    getEnv("TRACING_EXPORTER", tracing.ExporterNone),
+		ServiceName: getEnv("OTEL_SERVICE_NAME", "order-service"),
+	})
+	if err != nil {
+		logger.Fatalf("Ошибка настройки трассировки: %v", err)
+	}
+
+	// Подключение к БД
+
 	pg, err := db.NewPostgres(ctx, connString)
 	if err != nil {
 		logger.Fatalf("Ошибка подключения к БД: %v", err)
 	}
 	defer pg.Close()
 
-	repo := db.NewOrderRepository(pg)
+	// Миграции схемы при старте. Реплики применяют их по очереди под advisory lock
+	if getEnvAsBool("DB_AUTO_MIGRATE", false) {
+		migrator, err := db.NewMigrator(pg)
+		if err != nil {
+			logger.Fatalf("Ошибка загрузки миграций: %v", err)
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logger.Fatalf("Ошибка применения миграций: %v", err)
+		}
+		for _, m := range applied {
+			logger.Printf("Применена миграция %04d_%v", m.Version, m.Name)
+		}
+	}
+
+	repo := db.NewOrderRepository(pg, outboxConfig.Topic != "")
 
 	// Создание и заполнение кэша
 	cache := cache.NewCache(cacheSize)
@@ -94,28 +161,111 @@ func main() {
 	cache.Load(ordersMap)
 	logger.Printf("%v заказов загружено в кэш", len(ordersMap))
 
-	dataValidator := validator.New()
-	kafkaConsumer := kafka.NewConsumer(
-		[]string{kafkaBrokers},
+	// Топик для сообщений, которые не удалось обработать
+	var dlq *kafka.DeadLetterQueue
+	if kafkaConfig.DLQTopic != "" {
+		dlq, err = kafka.NewDeadLetterQueue(kafkaConfig.Brokers, kafkaConfig.DLQTopic, kafkaConfig.Security, logger)
+		if err != nil {
+			logger.Fatalf("Ошибка создания DLQ продюсера: %v", err)
+		}
+	}
+
+	// Декодер сообщений: JSON, а при настроенном Schema Registry ещё Avro и Protobuf
+	var schemaRegistry kafka.SchemaRegistry
+	if registryURL := getEnv("SCHEMA_REGISTRY_URL", ""); registryURL != "" {
+		schemaRegistry = kafka.NewRegistryClient(
+			registryURL,
+			getEnv("SCHEMA_REGISTRY_USERNAME", ""),
+			getEnv("SCHEMA_REGISTRY_PASSWORD", ""),
+		)
+	}
+	decoder := kafka.NewMultiDecoder(schemaRegistry)
+
+	// Необработанные сообщения сохраняются в карантин для разбора через /admin/quarantine
+	quarantine := db.NewQuarantineRepository(pg)
+
+	serviceMetrics := metrics.New()
+	// Валидация заказов и событий статуса; сообщения об ошибках на языке VALIDATION_LOCALE
+	dataValidator, err := validation.New(getEnv("VALIDATION_LOCALE", validation.LocaleRU), serviceMetrics.Validation)
+	if err != nil {
+		logger.Fatalf("Ошибка настройки валидации: %v", err)
+	}
+	kafkaConsumer, err := kafka.NewConsumer(
+		kafkaConfig,
 		repo,
 		cache,
+		dlq,
+		quarantine,
+		decoder,
 		dataValidator,
+		serviceMetrics.Consumer,
 		logger,
 	)
+	if err != nil {
+		logger.Fatalf("Ошибка создания консьюмера: %v", err)
+	}
+
+	// Консьюмер событий смены статуса товаров со своей DLQ. Включается KAFKA_STATUS_TOPIC
+	var statusConsumer *kafka.StatusConsumer
+	var statusDLQ *kafka.DeadLetterQueue
+	if statusConfig.Topic != "" {
+		if statusConfig.DLQTopic != "" {
+			statusDLQ, err = kafka.NewDeadLetterQueue(statusConfig.Brokers, statusConfig.DLQTopic, statusConfig.Security, logger)
+			if err != nil {
+				logger.Fatalf("Ошибка создания DLQ продюсера статусов: %v", err)
+			}
+		}
+		statusConsumer, err = kafka.NewStatusConsumer(statusConfig, repo, cache, statusDLQ, dataValidator, serviceMetrics.Consumer, logger)
+		if err != nil {
+			logger.Fatalf("Ошибка создания консьюмера статусов: %v", err)
+		}
+	}
+
+	// Публикация событий order.accepted из outbox. Без OUTBOX_TOPIC relay не запускается
+	// и события в outbox не пишутся
+	var outboxRelay *kafka.OutboxRelay
+	if outboxConfig.Topic != "" {
+		outboxRelay, err = kafka.NewOutboxRelay(kafkaConfig.Brokers, outboxConfig, kafkaConfig.Security, db.NewOutboxRepository(pg), logger)
+		if err != nil {
+			logger.Fatalf("Ошибка создания outbox relay: %v", err)
+		}
+	}
 
 	// Создание HTTP сервера
 	server := http.NewServer(httpPort, cache, repo, logger)
+	server.Handle("/metrics", serviceMetrics.Handler())
+	// Служебные эндпоинты включаются только с токеном
+	if adminToken != "" {
+		server.Handle("/admin/", http.NewAdminHandler(kafkaConsumer, quarantine, adminToken, logger))
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// Чтение из Kafka прекращается отменой consumeCtx; Start возвращает итог
+	// после дообработки полученных сообщений
+	consumeCtx, stopConsumers := context.WithCancel(ctx)
+	defer stopConsumers()
+
+	consumerDone := make(chan kafka.DrainStatus, 1)
 	go func() {
-		kafkaConsumer.Start(ctx)
+		consumerDone <- kafkaConsumer.Start(consumeCtx)
 	}()
+	statusConsumerDone := make(chan kafka.DrainStatus, 1)
+	if statusConsumer != nil {
+		go func() {
+			statusConsumerDone <- statusConsumer.Start(consumeCtx)
+		}()
+	}
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	if outboxRelay != nil {
+		go outboxRelay.Run(relayCtx)
+	}
 
 	// Запуск HTTP сервера
 	go func() {
-		if err := server.Start(); err != nil && err != ErrServerClosed {
+		if err := server.Start(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
 			logger.Fatalf("Ошибка запуска HTTP сервера: %v", err)
 		}
 	}()
@@ -125,9 +275,38 @@ func main() {
 	<-stop
 	logger.Println("Остановка...")
 
+	// Сначала консьюмеры дообрабатывают полученные заказы, и только потом
+	// закрываются reader, DLQ и пул соединений с БД
+	stopConsumers()
+	logDrainStatus(logger, "консьюмера заказов", <-consumerDone)
+	if statusConsumer != nil {
+		logDrainStatus(logger, "консьюмера статусов", <-statusConsumerDone)
+	}
+
 	if err := kafkaConsumer.Close(); err != nil {
 		logger.Printf("Ошибка закрытия консьюмера: %v", err)
 	}
+	if dlq != nil {
+		if err := dlq.Close(); err != nil {
+			logger.Printf("Ошибка закрытия DLQ продюсера: %v", err)
+		}
+	}
+	if statusConsumer != nil {
+		if err := statusConsumer.Close(); err != nil {
+			logger.Printf("Ошибка закрытия консьюмера статусов: %v", err)
+		}
+	}
+	if statusDLQ != nil {
+		if err := statusDLQ.Close(); err != nil {
+			logger.Printf("Ошибка закрытия DLQ продюсера статусов: %v", err)
+		}
+	}
+	stopRelay()
+	if outboxRelay != nil {
+		if err := outboxRelay.Close(); err != nil {
+			logger.Printf("Ошибка закрытия outbox relay: %v", err)
+		}
+	}
 
 	// Остановка HTTP сервера
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -136,9 +315,105 @@ func main() {
 		logger.Printf("Ошибка остановки HTTP сервера: %v", err)
 	}
 
+	// Отправка оставшихся спанов
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Printf("Ошибка остановки трассировки: %v", err)
+	}
+
 	logger.Println("Сервис остановлен")
 }
 
+func logDrainStatus(logger *log.Logger, name string, status kafka.DrainStatus) {
+	if !status.Drained {
+		logger.Printf("Остановка %v прервана по таймауту, %v сообщений будут прочитаны повторно", name, status.Uncommitted)
+		return
+	}
+	logger.Printf("Остановка %v завершена за %v, неподтверждённых сообщений: %v", name, status.Duration, status.Uncommitted)
+}
+
+// Настройки Kafka из окружения. Некорректная конфигурация останавливает запуск
+func loadKafkaConfig() kafka.Config {
+	cfg := kafka.DefaultConfig()
+
+	cfg.Brokers = kafka.ParseBrokers(getEnv("KAFKA_BROKERS", strings.Join(cfg.Brokers, ",")))
+	cfg.Topic = getEnv("KAFKA_TOPIC", cfg.Topic)
+	cfg.GroupID = getEnv("KAFKA_GROUP_ID", cfg.GroupID)
+	cfg.StartOffset = getEnv("KAFKA_START_OFFSET", cfg.StartOffset)
+	cfg.MinBytes = getEnvAsInt("KAFKA_MIN_BYTES", cfg.MinBytes)
+	cfg.MaxBytes = getEnvAsInt("KAFKA_MAX_BYTES", cfg.MaxBytes)
+	cfg.MaxWait = getEnvAsDuration("KAFKA_MAX_WAIT", cfg.MaxWait)
+	cfg.CommitInterval = getEnvAsDuration("KAFKA_COMMIT_INTERVAL", cfg.CommitInterval)
+	cfg.SessionTimeout = getEnvAsDuration("KAFKA_SESSION_TIMEOUT", cfg.SessionTimeout)
+	cfg.HeartbeatInterval = getEnvAsDuration("KAFKA_HEARTBEAT_INTERVAL", cfg.HeartbeatInterval)
+
+	cfg.Security.SASLMechanism = getEnv("KAFKA_SASL_MECHANISM", "")
+	cfg.Security.SASLUsername = getEnv("KAFKA_SASL_USERNAME", "")
+	cfg.Security.SASLPassword = getEnv("KAFKA_SASL_PASSWORD", "")
+	cfg.Security.TLSEnabled = getEnvAsBool("KAFKA_TLS_ENABLED", false)
+	cfg.Security.TLSCAFile = getEnv("KAFKA_TLS_CA_FILE", "")
+	cfg.Security.TLSCertFile = getEnv("KAFKA_TLS_CERT_FILE", "")
+	cfg.Security.TLSKeyFile = getEnv("KAFKA_TLS_KEY_FILE", "")
+	cfg.Security.TLSServerName = getEnv("KAFKA_TLS_SERVER_NAME", "")
+	cfg.Security.TLSInsecureSkipVerify = getEnvAsBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
+
+	cfg.DLQTopic = getEnv("KAFKA_DLQ_TOPIC", cfg.DLQTopic)
+	cfg.Workers = getEnvAsInt("KAFKA_WORKERS", cfg.Workers)
+	cfg.BatchSize = getEnvAsInt("KAFKA_BATCH_SIZE", cfg.BatchSize)
+	cfg.BatchWait = getEnvAsDuration("KAFKA_BATCH_WAIT", cfg.BatchWait)
+	cfg.DrainTimeout = getEnvAsDuration("KAFKA_DRAIN_TIMEOUT", cfg.DrainTimeout)
+	cfg.MaxUncommitted = getEnvAsInt("KAFKA_MAX_UNCOMMITTED", cfg.MaxUncommitted)
+
+	cfg.Retry.InitialInterval = getEnvAsDuration("RETRY_INITIAL_INTERVAL", cfg.Retry.InitialInterval)
+	cfg.Retry.MaxInterval = getEnvAsDuration("RETRY_MAX_INTERVAL", cfg.Retry.MaxInterval)
+	cfg.Retry.MaxElapsedTime = getEnvAsDuration("RETRY_MAX_ELAPSED", cfg.Retry.MaxElapsedTime)
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Ошибка конфигурации Kafka:\n%v", err)
+	}
+	return cfg
+}
+
+// Настройки консьюмера статусов: общие с заказами, кроме топика, группы и DLQ
+func loadStatusConfig(base kafka.Config) kafka.Config {
+	cfg := base
+	cfg.Topic = getEnv("KAFKA_STATUS_TOPIC", "")
+	cfg.GroupID = getEnv("KAFKA_STATUS_GROUP_ID", base.GroupID+"-status")
+	cfg.DLQTopic = getEnv("KAFKA_STATUS_DLQ_TOPIC", "order-status.dlq")
+	cfg.MissingItemWait = getEnvAsDuration("KAFKA_STATUS_MISSING_ITEM_WAIT", cfg.MissingItemWait)
+
+	if cfg.Topic == "" {
+		return cfg
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Ошибка конфигурации консьюмера статусов:\n%v", err)
+	}
+	return cfg
+}
+
+// Настройки публикации событий из outbox
+func loadOutboxConfig() kafka.OutboxConfig {
+	cfg := kafka.DefaultOutboxConfig()
+	cfg.Topic = getEnv("OUTBOX_TOPIC", cfg.Topic)
+	cfg.PollInterval = getEnvAsDuration("OUTBOX_POLL_INTERVAL", cfg.PollInterval)
+	cfg.BatchSize = getEnvAsInt("OUTBOX_BATCH_SIZE", cfg.BatchSize)
+
+	if cfg.PollInterval <= 0 || cfg.BatchSize <= 0 {
+		log.Fatalf("Ошибка конфигурации outbox: OUTBOX_POLL_INTERVAL и OUTBOX_BATCH_SIZE должны быть положительными")
+	}
+	return cfg
+}
+
+// Строка подключения к БД из окружения
+func loadConnString() string {
+	return buildConnString(
+		getEnv("DB_HOST", "localhost"),
+		getEnvAsInt("DB_PORT", 5432),
+		getEnv("DB_USER", "postgres"),
+		getRequiredEnv("DB_PASS"), // Обязательный параметр
+		getEnv("DB_NAME", "wbl0"),
+	)
+}
+
 func buildConnString(host string, port int, user, password, dbname string) string {
 	return fmt.Sprintf(
 		"host=%v port=%v user=%v password=%v dbname=%v sslmode=disable",
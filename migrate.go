@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"l0/internal/db"
+)
+
+const migrateUsage = `Использование: l0 migrate [флаги] <команда>
+
+Команды:
+  up                         применить все недостающие миграции
+  down [-steps N]            откатить N последних миграций (по умолчанию одну)
+  status                     список миграций и время их применения
+
+Флаги:
+`
+
+// Подкоманда migrate: управление схемой БД встроенными миграциями
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	steps := 1
+	command := fs.Arg(0)
+	switch command {
+	case "up", "status":
+	case "down":
+		downFlags := flag.NewFlagSet("down", flag.ContinueOnError)
+		downFlags.IntVar(&steps, "steps", 1, "сколько последних миграций откатить")
+		if err := downFlags.Parse(fs.Args()[1:]); err != nil {
+			return 2
+		}
+		if steps <= 0 {
+			fmt.Fprintln(os.Stderr, "-steps должен быть положительным")
+			return 2
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Неизвестная команда %q\n", command)
+		fs.Usage()
+		return 2
+	}
+
+	logger := log.New(os.Stderr, "ORDER-MIGRATE: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	pg, err := db.NewPostgres(ctx, loadConnString())
+	if err != nil {
+		logger.Printf("Ошибка подключения к БД: %v", err)
+		return 1
+	}
+	defer pg.Close()
+
+	migrator, err := db.NewMigrator(pg)
+	if err != nil {
+		logger.Printf("Ошибка загрузки миграций: %v", err)
+		return 1
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations(os.Stdout, "Применена", applied)
+		if err != nil {
+			logger.Printf("Ошибка применения миграций: %v", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Схема БД актуальна")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		printMigrations(os.Stdout, "Откачена", reverted)
+		if err != nil {
+			logger.Printf("Ошибка отката миграций: %v", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Нет применённых миграций")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Printf("Ошибка получения состояния миграций: %v", err)
+			return 1
+		}
+		printMigrationStatus(os.Stdout, statuses)
+	}
+	return 0
+}
+
+func printMigrations(w io.Writer, action string, migrations []db.Migration) {
+	for _, m := range migrations {
+		fmt.Fprintf(w, "%v миграция %04d_%v\n", action, m.Version, m.Name)
+	}
+}
+
+func printMigrationStatus(w io.Writer, statuses []db.MigrationStatus) {
+	for _, s := range statuses {
+		state := "не применена"
+		if s.AppliedAt != nil {
+			state = "применена " + s.AppliedAt.Local().Format(time.DateTime)
+		}
+		if s.Missing {
+			state += " (файла миграции нет в этой версии сервиса)"
+		}
+		fmt.Fprintf(w, "%04d_%-30v %v\n", s.Version, s.Name, state)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"l0/internal/generator"
+	"l0/internal/kafka"
+)
+
+const produceUsage = `Использование: l0 produce [флаги]
+
+Генерация случайных заказов, проходящих валидацию, с примесью невалидных
+сообщений, повторов и устаревших версий. Заказы отправляются в Kafka или,
+с -stdout, печатаются как JSONL (подходит для l0 replay -file).
+
+Флаги:
+`
+
+// Пачки при ограничении скорости набираются раз в rateTick
+const rateTick = 100 * time.Millisecond
+
+// orderSink — куда отправляются сгенерированные заказы
+type orderSink interface {
+	Publish(ctx context.Context, msgs ...kafka.OrderMessage) error
+	Close() error
+}
+
+// Подкоманда produce: генератор заказов для проверки и нагрузки сервиса
+func runProduce(args []string) int {
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+	count := fs.Int("count", 100, "число сообщений, 0 — до остановки")
+	rate := fs.Float64("rate", 0, "сообщений в секунду, 0 — без ограничения")
+	batch := fs.Int("batch", 100, "размер пачки без ограничения скорости")
+	invalid := fs.Float64("invalid", 0, "доля невалидных сообщений, от 0 до 1")
+	duplicates := fs.Float64("duplicates", 0, "доля повторов уже отправленных сообщений")
+	stale := fs.Float64("stale", 0, "доля устаревших версий уже отправленных заказов")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "начальное значение генератора")
+	topic := fs.String("topic", "", "топик Kafka (по умолчанию KAFKA_TOPIC)")
+	stdout := fs.Bool("stdout", false, "печатать JSONL в stdout вместо отправки в Kafka")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), produceUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := generator.Options{InvalidRatio: *invalid, DuplicateRatio: *duplicates, StaleRatio: *stale}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *count < 0 || *rate < 0 || *batch <= 0 {
+		fmt.Fprintln(os.Stderr, "-count и -rate не могут быть отрицательными, -batch должен быть положительным")
+		return 2
+	}
+
+	logger := log.New(os.Stderr, "ORDER-PRODUCER: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	var sink orderSink
+	if *stdout {
+		sink = &jsonlSink{w: bufio.NewWriter(os.Stdout)}
+	} else {
+		cfg := loadKafkaConfig()
+		if *topic != "" {
+			cfg.Topic = *topic
+		}
+		producer, err := kafka.NewOrderProducer(cfg.Brokers, cfg.Topic, cfg.Security)
+		if err != nil {
+			logger.Printf("Ошибка создания продюсера: %v", err)
+			return 1
+		}
+		sink = producer
+		logger.Printf("Отправка заказов в %v", cfg.Topic)
+	}
+	defer sink.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	sent, err := produce(ctx, generator.New(*seed, opts), sink, *count, *rate, *batch)
+	for _, kind := range []generator.Kind{generator.KindValid, generator.KindInvalid, generator.KindDuplicate, generator.KindStale} {
+		logger.Printf("%v: %v", kind, sent[kind])
+	}
+	if err != nil && ctx.Err() == nil {
+		logger.Printf("Ошибка отправки заказов: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Генерация и отправка пачками до count сообщений (0 — до отмены контекста).
+// Возвращает число отправленных сообщений каждого вида
+func produce(ctx context.Context, gen *generator.Generator, sink orderSink, count int, rate float64, batch int) (map[generator.Kind]int, error) {
+	sent := make(map[generator.Kind]int)
+
+	var ticker *time.Ticker
+	if rate > 0 {
+		ticker = time.NewTicker(rateTick)
+		defer ticker.Stop()
+	}
+
+	var budget float64
+	total := 0
+	for count == 0 || total < count {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		n := batch
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			case <-ticker.C:
+			}
+			// Дробная часть переносится на следующий тик
+			budget += rate * rateTick.Seconds()
+			n = int(budget)
+			budget -= float64(n)
+		}
+		if count > 0 && n > count-total {
+			n = count - total
+		}
+		if n == 0 {
+			continue
+		}
+
+		msgs := make([]kafka.OrderMessage, n)
+		kinds := make([]generator.Kind, n)
+		for i := range msgs {
+			msg, err := gen.Next()
+			if err != nil {
+				return sent, err
+			}
+			msgs[i] = kafka.OrderMessage{
+				OrderUID: msg.OrderUID,
+				EventID:  msg.EventID,
+				Version:  msg.Version,
+				Payload:  msg.Payload,
+			}
+			kinds[i] = msg.Kind
+		}
+
+		if err := sink.Publish(ctx, msgs...); err != nil {
+			return sent, err
+		}
+		for _, kind := range kinds {
+			sent[kind]++
+		}
+		total += n
+	}
+	return sent, nil
+}
+
+// Заказы в виде JSONL: только тело сообщения, по одному на строку
+type jsonlSink struct {
+	w *bufio.Writer
+}
+
+func (s *jsonlSink) Publish(ctx context.Context, msgs ...kafka.OrderMessage) error {
+	for _, msg := range msgs {
+		s.w.Write(msg.Payload)
+		s.w.WriteByte('\n')
+	}
+	return s.w.Flush()
+}
+
+func (s *jsonlSink) Close() error {
+	return s.w.Flush()
+}
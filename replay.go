@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"l0/internal/db"
+	"l0/internal/kafka"
+	"l0/internal/validation"
+)
+
+const replayUsage = `Использование: l0 replay [флаги]
+
+Повторная загрузка заказов из JSONL-файла (-file) или из диапазона топика (-topic).
+Сообщения проходят тот же путь, что и в консьюмере: декодирование, валидация,
+сохранение в БД. Кэш работающего сервиса не обновляется: он отдаёт прежние копии
+перезаписанных заказов до перезапуска. С -dry-run только проверяются, БД не нужна.
+
+Флаги:
+`
+
+// Подкоманда replay: повторная загрузка заказов из файла или топика
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := fs.String("file", "", "JSONL-файл с заказами, по одному на строку")
+	topic := fs.String("topic", "", "топик Kafka (по умолчанию KAFKA_TOPIC)")
+	partitions := fs.String("partitions", "", "партиции топика через запятую (по умолчанию все)")
+	fromOffset := fs.Int64("from-offset", -1, "первое смещение (по умолчанию с начала партиции)")
+	toOffset := fs.Int64("to-offset", -1, "последнее смещение включительно (по умолчанию до конца партиции)")
+	fromTime := fs.String("from-time", "", "время первого сообщения в формате RFC3339")
+	toTime := fs.String("to-time", "", "время последнего сообщения в формате RFC3339")
+	dryRun := fs.Bool("dry-run", false, "только проверить сообщения, ничего не сохраняя")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), replayUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*file == "") == (*topic == "") {
+		fmt.Fprintln(os.Stderr, "Нужно указать ровно один источник: -file или -topic")
+		fs.Usage()
+		return 2
+	}
+
+	logger := log.New(os.Stderr, "ORDER-REPLAY: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var source kafka.ReplaySource
+	var err error
+	if *file != "" {
+		source, err = kafka.NewFileSource(*file)
+	} else {
+		var rng kafka.TopicRange
+		rng, err = parseTopicRange(*partitions, *fromOffset, *toOffset, *fromTime, *toTime)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		cfg := loadKafkaConfig()
+		cfg.Topic = *topic
+		source, err = kafka.NewTopicSource(ctx, cfg, rng)
+	}
+	if err != nil {
+		logger.Printf("Ошибка открытия источника: %v", err)
+		return 1
+	}
+	defer source.Close()
+
+	// Реестр схем нужен для Avro и Protobuf сообщений из топика
+	var schemaRegistry kafka.SchemaRegistry
+	if registryURL := getEnv("SCHEMA_REGISTRY_URL", ""); registryURL != "" {
+		schemaRegistry = kafka.NewRegistryClient(
+			registryURL,
+			getEnv("SCHEMA_REGISTRY_USERNAME", ""),
+			getEnv("SCHEMA_REGISTRY_PASSWORD", ""),
+		)
+	}
+	decoder := kafka.NewMultiDecoder(schemaRegistry)
+
+	var repo db.OrderStore
+	if !*dryRun {
+		pg, err := db.NewPostgres(ctx, loadConnString())
+		if err != nil {
+			logger.Printf("Ошибка подключения к БД: %v", err)
+			return 1
+		}
+		defer pg.Close()
+		repo = db.NewOrderRepository(pg, loadOutboxConfig().Topic != "")
+	}
+
+	retry := kafka.DefaultRetryPolicy()
+	retry.InitialInterval = getEnvAsDuration("RETRY_INITIAL_INTERVAL", retry.InitialInterval)
+	retry.MaxInterval = getEnvAsDuration("RETRY_MAX_INTERVAL", retry.MaxInterval)
+	retry.MaxElapsedTime = getEnvAsDuration("RETRY_MAX_ELAPSED", retry.MaxElapsedTime)
+
+	dataValidator, err := validation.New(getEnv("VALIDATION_LOCALE", validation.LocaleRU), nil)
+	if err != nil {
+		logger.Printf("Ошибка настройки валидации: %v", err)
+		return 1
+	}
+
+	replayer := kafka.NewReplayer(
+		repo,
+		decoder,
+		dataValidator,
+		retry,
+		*dryRun,
+		logger,
+	)
+
+	report, err := replayer.Run(ctx, source)
+	printReplayReport(os.Stdout, report, *dryRun)
+	if err != nil {
+		logger.Printf("Повторная загрузка прервана: %v", err)
+		return 1
+	}
+	if len(report.Failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func parseTopicRange(partitions string, fromOffset, toOffset int64, fromTime, toTime string) (kafka.TopicRange, error) {
+	rng := kafka.TopicRange{FromOffset: fromOffset, ToOffset: toOffset}
+
+	for _, p := range strings.Split(partitions, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		partition, err := strconv.Atoi(p)
+		if err != nil || partition < 0 {
+			return rng, fmt.Errorf("неверный номер партиции: %q", p)
+		}
+		rng.Partitions = append(rng.Partitions, partition)
+	}
+
+	var err error
+	if fromTime != "" {
+		if rng.From, err = time.Parse(time.RFC3339, fromTime); err != nil {
+			return rng, fmt.Errorf("неверный формат -from-time: %v", err)
+		}
+	}
+	if toTime != "" {
+		if rng.To, err = time.Parse(time.RFC3339, toTime); err != nil {
+			return rng, fmt.Errorf("неверный формат -to-time: %v", err)
+		}
+	}
+	if toOffset >= 0 && fromOffset > toOffset {
+		return rng, fmt.Errorf("-from-offset больше -to-offset")
+	}
+	if !rng.From.IsZero() && !rng.To.IsZero() && rng.From.After(rng.To) {
+		return rng, fmt.Errorf("-from-time позже -to-time")
+	}
+	return rng, nil
+}
+
+func printReplayReport(w *os.File, report kafka.ReplayReport, dryRun bool) {
+	fmt.Fprintf(w, "Сообщений: %v\n", report.Total)
+	fmt.Fprintf(w, "Прошли проверку: %v\n", report.Valid)
+	if !dryRun {
+		fmt.Fprintf(w, "Сохранено: %v\n", report.Saved)
+		fmt.Fprintf(w, "Удалено: %v\n", report.Deleted)
+		fmt.Fprintf(w, "Устаревших версий: %v\n", report.Stale)
+	}
+
+	classes := make([]string, 0, len(report.Failed))
+	for class := range report.Failed {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(w, "Ошибок %v: %v\n", class, report.Failed[kafka.ErrorClass(class)])
+	}
+
+	for _, f := range report.Failures {
+		fmt.Fprintf(w, "  partition=%v offset=%v %v: %v\n", f.Partition, f.Offset, f.Class, f.Err)
+	}
+}